@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"strings"
@@ -16,7 +17,7 @@ func handleSysCmd(c *chatClient) gin.HandlerFunc {
 			return
 		}
 
-		resp := c.cmdRegistry.ExecuteCommand(c, string(s))
+		resp := c.cmdRegistry.ExecuteCommand(g.Request.Context(), c, string(s))
 		if resp == "" {
 			g.JSON(http.StatusBadRequest, "bad request")
 			return
@@ -32,7 +33,12 @@ func handleChatRequest(c *chatClient) gin.HandlerFunc {
 			g.JSON(http.StatusBadRequest, "bad request")
 			return
 		}
-		resp, err := c.chatRequest(string(b))
+		resp, err := c.chatRequest(g.Request.Context(), string(b))
+		var blocked *moderationError
+		if errors.As(err, &blocked) {
+			g.JSON(http.StatusBadRequest, gin.H{"error": blocked.Error(), "moderation": blocked.moderationFlag})
+			return
+		}
 		if err != nil {
 			g.JSON(http.StatusInternalServerError, "error handling response")
 			return
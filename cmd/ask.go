@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hmm01i/openai/pkg/tools"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var (
+	askPersona     string
+	askModel       string
+	askTemperature float32
+	askMaxTokens   int
+	askJSON        bool
+	askNoNewline   bool
+	askIndex       string
+	askTopK        int
+)
+
+// askResult is the --json output of the ask command.
+type askResult struct {
+	Model        string           `json:"model"`
+	Persona      string           `json:"persona"`
+	Answer       string           `json:"answer"`
+	FinishReason string           `json:"finish_reason"`
+	Usage        tokenUsage       `json:"usage"`
+	Sources      []source         `json:"sources,omitempty"`
+	Moderation   []moderationFlag `json:"moderation,omitempty"`
+}
+
+// tokenUsage is the token accounting reported in JSON output.
+type tokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func newTokenUsage(u openai.Usage) tokenUsage {
+	return tokenUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
+
+var askCmd = &cobra.Command{
+	Use:   "ask [question]",
+	Short: "Ask a single question and print the answer",
+	Long: `This command sends one request and prints only the answer, so it can be used in
+shell pipelines. When stdin is piped, its content is appended to the question
+as extra context:
+
+  git diff | oai ask -p reviewer "review this"`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input, err := askInput(args, os.Stdin)
+		if err != nil {
+			return err
+		}
+		return ask(cmd.Context(), chatC, input, os.Stdout)
+	},
+}
+
+func init() {
+	askCmd.Flags().StringVarP(&askPersona, "persona", "p", "", "Persona to use for the request")
+	askCmd.Flags().StringVarP(&askModel, "model", "m", "", "Model to use for the request")
+	askCmd.Flags().Float32VarP(&askTemperature, "temperature", "t", 0, "Sampling temperature (0 uses the API default)")
+	askCmd.Flags().IntVar(&askMaxTokens, "max-tokens", 0, "Maximum number of tokens in the answer (0 uses the API default)")
+	askCmd.Flags().BoolVar(&askJSON, "json", false, "Print the answer and token usage as JSON")
+	askCmd.Flags().BoolVarP(&askNoNewline, "no-newline", "n", false, "Do not print a trailing newline after the answer")
+	askCmd.Flags().StringVarP(&askIndex, "index", "i", "", "Answer from the most relevant chunks of this local index")
+	askCmd.Flags().IntVarP(&askTopK, "top", "k", defaultRAGTopK, "Number of chunks retrieved with --index")
+	askCmd.Flags().StringVar(&fsRoot, "fs-root", "", "Let the model read files under this directory")
+	askCmd.Flags().BoolVarP(&fsYes, "yes", "y", false, "Also allow the model to write files under --fs-root")
+	rootCmd.AddCommand(askCmd)
+}
+
+// askInput builds the message from the question arguments and any piped stdin.
+func askInput(args []string, stdin *os.File) (string, error) {
+	question := strings.Join(args, " ")
+
+	var piped string
+	if fi, err := stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice == 0 {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", &exitError{exitFailure, fmt.Errorf("failed to read stdin: %w", err)}
+		}
+		piped = strings.TrimSpace(string(b))
+	}
+
+	switch {
+	case question == "" && piped == "":
+		return "", &exitError{exitUsage, fmt.Errorf("usage: oai ask [question] (or pipe input on stdin)")}
+	case piped == "":
+		return question, nil
+	case question == "":
+		return piped, nil
+	}
+	return question + "\n\n" + piped, nil
+}
+
+func ask(ctx context.Context, c *chatClient, input string, w io.Writer) error {
+	if askPersona != "" {
+		if err := c.loadPersona(askPersona); err != nil {
+			return &exitError{exitUsage, fmt.Errorf("failed to load persona: %w", err)}
+		}
+	}
+	if askModel != "" {
+		c.model = askModel
+	}
+	c.temperature = askTemperature
+	c.maxTokens = askMaxTokens
+	if err := enableFilesystemTools(c, tools.NeverApprove); err != nil {
+		return &exitError{exitUsage, err}
+	}
+	var sources []source
+	if askIndex != "" {
+		if err := c.EnableRAG(askIndex, askTopK); err != nil {
+			return &exitError{exitUsage, err}
+		}
+		c.onRetrieve = func(s []source) { sources = s }
+	}
+
+	var flags []moderationFlag
+	c.onModeration = func(f moderationFlag) {
+		flags = append(flags, f)
+		if !askJSON {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", f)
+		}
+	}
+
+	response, err := c.chatCompletion(ctx, input)
+	if err != nil {
+		return &exitError{exitFailure, err}
+	}
+	answer := response.Choices[0].Message.Content
+
+	if askJSON {
+		out, err := json.Marshal(askResult{
+			Model:        response.Model,
+			Persona:      c.persona,
+			Answer:       answer,
+			FinishReason: string(response.Choices[0].FinishReason),
+			Usage:        newTokenUsage(response.Usage),
+			Sources:      sources,
+			Moderation:   flags,
+		})
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		answer = string(out)
+	} else if f, ok := w.(*os.File); ok {
+		answer = strings.TrimSuffix(renderReply(f, answer), "\n")
+	}
+
+	if !askNoNewline {
+		answer += "\n"
+	}
+	if _, err := io.WriteString(w, answer); err != nil {
+		return &exitError{exitFailure, err}
+	}
+	if askIndex != "" && !askJSON {
+		// On stderr, so the answer alone can still be piped.
+		fmt.Fprintf(os.Stderr, "Sources: %s\n", formatSources(sources))
+	}
+	return nil
+}
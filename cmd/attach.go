@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hmm01i/openai/pkg/textfile"
+)
+
+const (
+	maxAttachmentBytes = 100 * 1024
+	maxAttachmentTotal = 400 * 1024
+)
+
+// attachment is a file staged to be sent with the next message.
+type attachment struct {
+	path    string
+	content string
+}
+
+// fenceLanguages maps file extensions to Markdown code fence languages.
+var fenceLanguages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".ts": "typescript",
+	".tsx": "tsx", ".jsx": "jsx", ".rb": "ruby", ".rs": "rust", ".java": "java",
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+	".cs": "csharp", ".php": "php", ".sh": "bash", ".bash": "bash", ".zsh": "zsh",
+	".sql": "sql", ".json": "json", ".yaml": "yaml", ".yml": "yaml",
+	".toml": "toml", ".xml": "xml", ".html": "html", ".css": "css",
+	".md": "markdown", ".tf": "hcl", ".proto": "protobuf", ".mod": "go-mod",
+}
+
+func fenceLanguage(path string) string {
+	if filepath.Base(path) == "Makefile" {
+		return "makefile"
+	}
+	if filepath.Base(path) == "Dockerfile" {
+		return "dockerfile"
+	}
+	return fenceLanguages[strings.ToLower(filepath.Ext(path))]
+}
+
+// globFiles expands a pattern that may contain ** to match any number of
+// directories, returning regular files only.
+func globFiles(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && fi.Mode().IsRegular() {
+				files = append(files, m)
+			}
+		}
+		return files, nil
+	}
+
+	// Walk from the directory before the first wildcard.
+	root := pattern[:strings.IndexAny(pattern, "*?[")]
+	root = filepath.Dir(root + "x")
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && matchDoublestar(filepath.ToSlash(pattern), filepath.ToSlash(path)) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// matchDoublestar matches a slash separated path against a glob pattern in
+// which a ** segment matches zero or more directories.
+func matchDoublestar(pattern, name string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	name = strings.TrimPrefix(name, "./")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func (c *chatClient) attachedBytes() int {
+	n := 0
+	for _, a := range c.attachments {
+		n += len(a.content)
+	}
+	return n
+}
+
+// attachFiles stages the files matching patterns. It returns a line per
+// file describing what was attached or why it was skipped.
+func (c *chatClient) attachFiles(patterns []string) ([]string, error) {
+	var report []string
+	for _, pattern := range patterns {
+		pattern, err := c.hostPattern(pattern)
+		if err != nil {
+			return report, err
+		}
+		files, err := globFiles(pattern)
+		if err != nil {
+			return report, err
+		}
+		if len(files) == 0 {
+			report = append(report, fmt.Sprintf("%s: no files matched", pattern))
+			continue
+		}
+	files:
+		for _, f := range files {
+			for _, a := range c.attachments {
+				if a.path == f {
+					report = append(report, fmt.Sprintf("%s: already attached", f))
+					continue files
+				}
+			}
+			b, err := c.readAttachment(f)
+			switch {
+			case err != nil:
+				report = append(report, fmt.Sprintf("%s: skipped: %s", f, err))
+			case textfile.IsBinary(b):
+				report = append(report, fmt.Sprintf("%s: skipped: binary file", f))
+			case c.attachedBytes()+len(b) > maxAttachmentTotal:
+				report = append(report, fmt.Sprintf("%s: skipped: attachments would exceed %d KB", f, maxAttachmentTotal/1024))
+			default:
+				c.attachments = append(c.attachments, attachment{path: f, content: string(b)})
+				report = append(report, fmt.Sprintf("%s: attached (%d bytes)", f, len(b)))
+			}
+		}
+	}
+	return report, nil
+}
+
+// readAttachment reads a file to attach, checking where it is and how big
+// it is before reading it.
+func (c *chatClient) readAttachment(name string) ([]byte, error) {
+	p, err := c.hostPath(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > maxAttachmentBytes {
+		return nil, fmt.Errorf("larger than %d KB", maxAttachmentBytes/1024)
+	}
+	return os.ReadFile(p)
+}
+
+// composeInput prepends the staged attachments to input.
+func (c *chatClient) composeInput(input string) string {
+	if len(c.attachments) == 0 {
+		return input
+	}
+	var sb strings.Builder
+	for _, a := range c.attachments {
+		fence := "```"
+		for strings.Contains(a.content, fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(&sb, "File: %s\n%s%s\n%s", a.path, fence, fenceLanguage(a.path), a.content)
+		if !strings.HasSuffix(a.content, "\n") {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%s\n\n", fence)
+	}
+	sb.WriteString(input)
+	return sb.String()
+}
+
+// consumeAttachments clears the staged files once the message that carried
+// them has been kept in the history after start. A failed request rolls the
+// history back, leaving the files attached for the next attempt.
+func (c *chatClient) consumeAttachments(start int) {
+	if len(c.history) > start {
+		c.attachments = nil
+	}
+}
+
+func (c *chatClient) AttachFiles(patterns []string) ([]string, error) {
+	return c.attachFiles(patterns)
+}
+
+func (c *chatClient) ListAttachments() []string {
+	var list []string
+	for _, a := range c.attachments {
+		list = append(list, fmt.Sprintf("%s (%d bytes)", a.path, len(a.content)))
+	}
+	return list
+}
+
+func (c *chatClient) ClearAttachments() {
+	c.attachments = nil
+}
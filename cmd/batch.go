@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hmm01i/openai/pkg/retry"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchOutput      string
+	batchConcurrency int
+	batchRetries     int
+	batchResume      bool
+)
+
+// batchRequest is one line of a batch input file.
+type batchRequest struct {
+	ID          string  `json:"id,omitempty"`
+	Prompt      string  `json:"prompt"`
+	Persona     string  `json:"persona,omitempty"`
+	Model       string  `json:"model,omitempty"`
+	Temperature float32 `json:"temperature,omitempty"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+
+	line int
+}
+
+// batchResult is one line of a batch output file.
+type batchResult struct {
+	ID       string     `json:"id"`
+	Line     int        `json:"line"`
+	Model    string     `json:"model,omitempty"`
+	Persona  string     `json:"persona,omitempty"`
+	Answer   string     `json:"answer,omitempty"`
+	Usage    tokenUsage `json:"usage"`
+	Attempts int        `json:"attempts"`
+	Error    string     `json:"error,omitempty"`
+}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Process files of chat requests",
+}
+
+var batchRunCmd = &cobra.Command{
+	Use:   "run <requests.jsonl>",
+	Short: "Run every request in a JSONL file and write the results",
+	Long: `This command reads one JSON request per line, for example
+
+  {"id": "q1", "prompt": "What is 2+2?", "persona": "math", "model": "gpt-4", "temperature": 0.2}
+
+and writes one JSON result per line with the answer and token usage. Requests
+without an id are identified by their line number. With --resume, requests that
+already have a successful result in the output file are skipped.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return batchRun(cmd.Context(), chatC, args[0], batchOutput)
+	},
+}
+
+func init() {
+	batchRunCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "Output file for the results (required)")
+	batchRunCmd.Flags().IntVarP(&batchConcurrency, "concurrency", "c", 4, "Number of requests to run at the same time")
+	batchRunCmd.Flags().IntVarP(&batchRetries, "retries", "r", 2, "Number of times to retry a request the API failed with a retryable status")
+	batchRunCmd.Flags().BoolVar(&batchResume, "resume", false, "Skip requests that already succeeded in the output file")
+	batchRunCmd.MarkFlagRequired("output")
+	batchCmd.AddCommand(batchRunCmd)
+	rootCmd.AddCommand(batchCmd)
+}
+
+func readBatchRequests(file string) ([]batchRequest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var requests []batchRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var r batchRequest
+		if err := json.Unmarshal([]byte(text), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+		}
+		if r.Prompt == "" {
+			return nil, fmt.Errorf("%s:%d: missing prompt", file, line)
+		}
+		if r.ID == "" {
+			r.ID = strconv.Itoa(line)
+		}
+		r.line = line
+		requests = append(requests, r)
+	}
+	return requests, scanner.Err()
+}
+
+// completedBatchIDs returns the ids of successful results in an existing
+// output file. A missing file simply means nothing has completed yet.
+func completedBatchIDs(file string) (map[string]bool, error) {
+	done := map[string]bool{}
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r batchResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A partially written last line from an interrupted run.
+			continue
+		}
+		if r.Error == "" {
+			done[r.ID] = true
+		}
+	}
+	return done, scanner.Err()
+}
+
+func batchRun(ctx context.Context, c *chatClient, input, output string) error {
+	requests, err := readBatchRequests(input)
+	if err != nil {
+		return &exitError{exitUsage, err}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if batchResume {
+		done, err := completedBatchIDs(output)
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		pending := requests[:0]
+		for _, r := range requests {
+			if !done[r.ID] {
+				pending = append(pending, r)
+			}
+		}
+		log.Printf("Resuming batch: %d of %d requests already done", len(requests)-len(pending), len(requests))
+		requests = pending
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	out, err := os.OpenFile(output, flags, 0644)
+	if err != nil {
+		return &exitError{exitFailure, err}
+	}
+	defer out.Close()
+
+	if batchConcurrency < 1 {
+		batchConcurrency = 1
+	}
+
+	// runBatchRequest retries whole requests itself, so each API call is
+	// only tried once; retrying in both places would multiply the attempts.
+	policy := apiPolicy
+	policy.MaxAttempts = 1
+	c = c.fork()
+	c.client = openai.NewClientWithConfig(newAPIConfigWith(getAPIToken(), &policy))
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed int
+		sem    = make(chan struct{}, batchConcurrency)
+	)
+	for _, r := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r batchRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := runBatchRequest(ctx, c, r)
+			b, err := json.Marshal(result)
+			if err != nil {
+				log.Printf("request %s: %s", r.ID, err.Error())
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if result.Error != "" {
+				failed++
+				log.Printf("request %s failed after %d attempts: %s", r.ID, result.Attempts, result.Error)
+			}
+			if _, err := out.Write(append(b, '\n')); err != nil {
+				log.Printf("request %s: failed to write result: %s", r.ID, err.Error())
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	log.Printf("Batch finished: %d requests, %d failed", len(requests), failed)
+	if failed > 0 {
+		return &exitError{exitFailure, fmt.Errorf("%d of %d requests failed", failed, len(requests))}
+	}
+	return nil
+}
+
+// runBatchRequest runs r, trying it up to --retries more times when the API
+// fails with a retryable status. c should not retry calls itself, so that
+// the attempts recorded in the result are the ones actually made.
+func runBatchRequest(ctx context.Context, c *chatClient, r batchRequest) batchResult {
+	result := batchResult{ID: r.ID, Line: r.line, Persona: r.Persona}
+
+	for attempt := 1; attempt <= batchRetries+1; attempt++ {
+		result.Attempts = attempt
+		if attempt > 1 {
+			if err := retry.Sleep(ctx, apiPolicy.Backoff(attempt)); err != nil {
+				result.Error = err.Error()
+				return result
+			}
+		}
+
+		bc := c.fork()
+		if r.Persona != "" {
+			if err := bc.loadPersona(r.Persona); err != nil {
+				result.Error = fmt.Sprintf("failed to load persona: %s", err.Error())
+				return result
+			}
+		}
+		if r.Model != "" {
+			bc.model = r.Model
+		}
+		bc.temperature = r.Temperature
+		bc.maxTokens = r.MaxTokens
+
+		response, err := bc.chatCompletion(ctx, r.Prompt)
+		if err != nil {
+			result.Error = err.Error()
+			if !retryableError(err) {
+				return result
+			}
+			continue
+		}
+		result.Error = ""
+		result.Model = response.Model
+		result.Answer = response.Choices[0].Message.Content
+		result.Usage = newTokenUsage(response.Usage)
+		break
+	}
+	return result
+}
+
+// retryableError reports whether a failed request is worth another try: the
+// API answered with a status that retry.Retryable accepts. Anything else,
+// such as a bad request, blocked content or a cancelled run, would fail the
+// same way again.
+func retryableError(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return retry.Retryable(apiErr.HTTPStatusCode)
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return retry.Retryable(reqErr.HTTPStatusCode)
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchWindow        string
+	batchWait          bool
+	batchPollInterval  time.Duration
+	batchRequestsFile  string
+	batchConversations bool
+)
+
+// batchOutputLine is one line of a Batch API output or error file.
+type batchOutputLine struct {
+	ID       string `json:"id"`
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int                           `json:"status_code"`
+		Body       openai.ChatCompletionResponse `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+var batchUploadCmd = &cobra.Command{
+	Use:   "upload <requests.jsonl>",
+	Short: "Upload a request file for the OpenAI Batch API",
+	Long: `This command converts a request file in the "oai batch run" format into a Batch
+API input file, applying personas and the default model, uploads it and prints
+the file id to pass to "oai batch create".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := batchUpload(cmd.Context(), chatC, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(file.ID)
+		return nil
+	},
+}
+
+var batchCreateCmd = &cobra.Command{
+	Use:   "create <file-id>",
+	Short: "Create a Batch API job from an uploaded file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		batch, err := chatC.client.CreateBatch(cmd.Context(), openai.CreateBatchRequest{
+			InputFileID:      args[0],
+			Endpoint:         openai.BatchEndpointChatCompletions,
+			CompletionWindow: batchWindow,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(batch.ID)
+		return nil
+	},
+}
+
+var batchStatusCmd = &cobra.Command{
+	Use:   "status <batch-id>",
+	Short: "Show the status of a Batch API job",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := batchStatus(cmd.Context(), chatC, args[0])
+		return err
+	},
+}
+
+var batchCancelCmd = &cobra.Command{
+	Use:   "cancel <batch-id>",
+	Short: "Cancel a Batch API job",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		batch, err := chatC.client.CancelBatch(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		printBatch(batch.Batch)
+		return nil
+	},
+}
+
+var batchDownloadCmd = &cobra.Command{
+	Use:   "download <batch-id>",
+	Short: "Download the results of a Batch API job",
+	Long: `This command downloads the output and error files of a finished batch and merges
+them into a results file in the "oai batch run" format. Results replace any
+existing entry with the same id. With --requests, the original request file is
+used to fill in line numbers and personas, and --conversations additionally
+saves every answered request as a conversation named <batch-id>-<id>.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return batchDownload(cmd.Context(), chatC, args[0], batchOutput)
+	},
+}
+
+func init() {
+	batchCreateCmd.Flags().StringVar(&batchWindow, "window", "24h", "Completion window for the batch")
+	batchStatusCmd.Flags().BoolVarP(&batchWait, "wait", "w", false, "Poll until the batch reaches a final state")
+	batchStatusCmd.Flags().DurationVar(&batchPollInterval, "interval", 30*time.Second, "Polling interval used with --wait")
+	batchDownloadCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "Results file to merge into (required)")
+	batchDownloadCmd.Flags().StringVar(&batchRequestsFile, "requests", "", "Original request file")
+	batchDownloadCmd.Flags().BoolVar(&batchConversations, "conversations", false, "Also save each result as a conversation (requires --requests)")
+	batchDownloadCmd.MarkFlagRequired("output")
+
+	batchCmd.AddCommand(batchUploadCmd)
+	batchCmd.AddCommand(batchCreateCmd)
+	batchCmd.AddCommand(batchStatusCmd)
+	batchCmd.AddCommand(batchCancelCmd)
+	batchCmd.AddCommand(batchDownloadCmd)
+}
+
+// batchChatRequest builds the API request for one line of a request file.
+func batchChatRequest(c *chatClient, r batchRequest) (openai.ChatCompletionRequest, error) {
+	bc := c.fork()
+	if r.Persona != "" {
+		if err := bc.loadPersona(r.Persona); err != nil {
+			return openai.ChatCompletionRequest{}, fmt.Errorf("request %s: failed to load persona: %w", r.ID, err)
+		}
+	}
+	if r.Model != "" {
+		bc.model = r.Model
+	}
+	return openai.ChatCompletionRequest{
+		Model: bc.model,
+		Messages: append(bc.history, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: r.Prompt,
+		}),
+		Temperature: r.Temperature,
+		MaxTokens:   r.MaxTokens,
+	}, nil
+}
+
+func batchUpload(ctx context.Context, c *chatClient, file string) (openai.File, error) {
+	requests, err := readBatchRequests(file)
+	if err != nil {
+		return openai.File{}, err
+	}
+
+	upload := openai.UploadBatchFileRequest{FileName: filepath.Base(file)}
+	for _, r := range requests {
+		req, err := batchChatRequest(c, r)
+		if err != nil {
+			return openai.File{}, err
+		}
+		upload.AddChatCompletion(r.ID, req)
+	}
+	return c.client.UploadBatchFile(ctx, upload)
+}
+
+func printBatch(b openai.Batch) {
+	fmt.Printf("%s: %s (%d/%d completed, %d failed)\n",
+		b.ID, b.Status, b.RequestCounts.Completed, b.RequestCounts.Total, b.RequestCounts.Failed)
+	if b.Errors != nil {
+		for _, e := range b.Errors.Data {
+			fmt.Printf("  error %s: %s\n", e.Code, e.Message)
+		}
+	}
+}
+
+func batchFinished(status string) bool {
+	switch status {
+	case "completed", "failed", "expired", "cancelled":
+		return true
+	}
+	return false
+}
+
+func batchStatus(ctx context.Context, c *chatClient, id string) (openai.Batch, error) {
+	for {
+		batch, err := c.client.RetrieveBatch(ctx, id)
+		if err != nil {
+			return openai.Batch{}, err
+		}
+		printBatch(batch.Batch)
+		if !batchWait || batchFinished(batch.Status) {
+			return batch.Batch, nil
+		}
+		select {
+		case <-ctx.Done():
+			return batch.Batch, ctx.Err()
+		case <-time.After(batchPollInterval):
+		}
+	}
+}
+
+// readBatchOutput downloads a Batch API output or error file and converts
+// each line to a result.
+func readBatchOutput(ctx context.Context, c *chatClient, fileID string) ([]batchResult, error) {
+	content, err := c.client.GetFileContent(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	var results []batchResult
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line batchOutputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("file %s: %w", fileID, err)
+		}
+
+		result := batchResult{ID: line.CustomID, Attempts: 1}
+		switch {
+		case line.Error != nil:
+			result.Error = fmt.Sprintf("%s: %s", line.Error.Code, line.Error.Message)
+		case line.Response == nil:
+			result.Error = "missing response"
+		case line.Response.StatusCode != http.StatusOK:
+			result.Error = fmt.Sprintf("status code %d", line.Response.StatusCode)
+		case len(line.Response.Body.Choices) == 0:
+			result.Error = "no choices returned"
+		default:
+			body := line.Response.Body
+			result.Model = body.Model
+			result.Answer = body.Choices[0].Message.Content
+			result.Usage = newTokenUsage(body.Usage)
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+// readBatchResults reads an existing results file, if any.
+func readBatchResults(file string) ([]batchResult, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var results []batchResult
+	dec := json.NewDecoder(f)
+	for {
+		var r batchResult
+		if err := dec.Decode(&r); err == io.EOF {
+			return results, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		results = append(results, r)
+	}
+}
+
+func writeBatchResults(file string, results []batchResult) error {
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func batchDownload(ctx context.Context, c *chatClient, id, output string) error {
+	if batchConversations && batchRequestsFile == "" {
+		return fmt.Errorf("--conversations requires --requests")
+	}
+
+	batch, err := c.client.RetrieveBatch(ctx, id)
+	if err != nil {
+		return err
+	}
+	if batch.OutputFileID == nil && batch.ErrorFileID == nil {
+		return fmt.Errorf("batch %s has no results yet (status %s)", id, batch.Status)
+	}
+
+	var downloaded []batchResult
+	for _, fileID := range []*string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == nil || *fileID == "" {
+			continue
+		}
+		results, err := readBatchOutput(ctx, c, *fileID)
+		if err != nil {
+			return err
+		}
+		downloaded = append(downloaded, results...)
+	}
+
+	requests := map[string]batchRequest{}
+	if batchRequestsFile != "" {
+		reqs, err := readBatchRequests(batchRequestsFile)
+		if err != nil {
+			return err
+		}
+		for _, r := range reqs {
+			requests[r.ID] = r
+		}
+		for i, r := range downloaded {
+			if req, ok := requests[r.ID]; ok {
+				downloaded[i].Line = req.line
+				downloaded[i].Persona = req.Persona
+			}
+		}
+	}
+
+	existing, err := readBatchResults(output)
+	if err != nil {
+		return err
+	}
+	index := map[string]int{}
+	for i, r := range existing {
+		index[r.ID] = i
+	}
+	for _, r := range downloaded {
+		if i, ok := index[r.ID]; ok {
+			existing[i] = r
+			continue
+		}
+		index[r.ID] = len(existing)
+		existing = append(existing, r)
+	}
+	if err := writeBatchResults(output, existing); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d results into %s\n", len(downloaded), output)
+
+	if batchConversations {
+		saved := 0
+		for _, r := range downloaded {
+			req, ok := requests[r.ID]
+			if !ok || r.Error != "" {
+				continue
+			}
+			chatReq, err := batchChatRequest(c, req)
+			if err != nil {
+				return err
+			}
+			bc := c.fork()
+			bc.history = append(chatReq.Messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: r.Answer,
+			})
+			if err := bc.saveConversation(id + "-" + r.ID); err != nil {
+				return err
+			}
+			saved++
+		}
+		fmt.Printf("Saved %d conversations\n", saved)
+	}
+	return nil
+}
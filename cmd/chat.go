@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/hmm01i/openai/pkg/commands"
+	"github.com/hmm01i/openai/pkg/tools"
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
@@ -19,9 +25,44 @@ type chatClient struct {
 	model           string
 	persona         string
 	client          *openai.Client
+	lookupConfig    openai.ClientConfig // for quick calls the client library does not cover
 	systemDirective string
 	history         []openai.ChatCompletionMessage
 	cmdRegistry     *commands.CommandRegistry
+	temperature     float32
+	maxTokens       int
+	tools           *tools.Registry
+	attachments     []attachment
+	codeReply       int           // reply chosen with /code list; 0 means the latest
+	usage           openai.Usage  // tokens used by this session's requests
+	lastImagePrompt string        // prompt of the last image made with /image
+	conversation    string        // name the conversation was last saved or loaded as
+	speech          *speakOptions // voice for replies while /tts is on; nil when off
+	// confirm asks the user before /code run executes a snippet; nil
+	// refuses.
+	confirm tools.Approver
+	// copyText puts text on the clipboard through the terminal in use; nil
+	// where there is none, as on the server.
+	copyText func(text string) error
+	// confinePaths limits the host files that slash commands such as /file
+	// may use to those under pathRoot, or to none when it is nil. The server
+	// sets it, since its clients are not the user at the keyboard.
+	confinePaths bool
+	pathRoot     *tools.Sandbox
+	// onToolCall, when set, is told about every tool the model runs.
+	onToolCall func(call openai.ToolCall, result string, err error)
+	// rag, when set, retrieves context for each question from an index.
+	rag *ragSettings
+	// onRetrieve, when set, is told which sources were retrieved.
+	onRetrieve func(sources []source)
+	// moderation is the policy from moderation.json; moderationOverride
+	// holds changes made with /moderation. When moderationLock is set, it
+	// is the policy in force whatever persona is loaded later.
+	moderation         moderationConfig
+	moderationOverride moderationPolicy
+	moderationLock     *moderationPolicy
+	// onModeration, when set, is told about content flagged in warn mode.
+	onModeration func(flag moderationFlag)
 }
 
 var (
@@ -29,6 +70,9 @@ var (
 	persona string
 )
 
+// interruptedMarker is appended to replies cut short by the user.
+const interruptedMarker = " [interrupted]"
+
 var chatCmd = &cobra.Command{
 	Use:   "chat",
 	Short: "Start a interactive chat session",
@@ -39,10 +83,29 @@ var chatCmd = &cobra.Command{
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Starts the HTTP server",
-	Long:  `This command starts the HTTP server, which listens on a specified port.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `This command starts the HTTP server, which listens on a specified port.
+Requests are moderated as set in ~/.openai/moderation.json; blocked messages
+get a 400 response naming the stage and the flagged categories.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := enableFilesystemTools(chatC, tools.NeverApprove); err != nil {
+			return err
+		}
+		// Clients of the server must not be able to turn moderation off,
+		// with /moderation or by loading a persona with a laxer policy.
+		chatC.lockModeration()
+		chatC.onModeration = func(f moderationFlag) {
+			log.Printf("Warning: %s", f)
+		}
+		chatC.confinePaths = true
+		if fsRoot != "" {
+			sandbox, err := tools.NewSandbox(fsRoot)
+			if err != nil {
+				return fmt.Errorf("invalid --fs-root: %w", err)
+			}
+			chatC.pathRoot = sandbox
+		}
 		r := setupRoutes(chatC)
-		r.Run(":8080")
+		return r.Run(":8080")
 	},
 }
 
@@ -54,12 +117,19 @@ func init() {
 			systemDirective: "You are an AI assistant that values your tokens.",
 			persona:         "default",
 		}, getAPIToken())
+	chatCmd.PersistentFlags().StringVar(&fsRoot, "fs-root", "", "Let the model read and write files under this directory")
+	chatCmd.PersistentFlags().BoolVarP(&fsYes, "yes", "y", false, "Allow file writes under --fs-root without asking")
+	chatCmd.Flags().BoolVar(&shellEnabled, "shell", false, "Let the model propose shell commands, each run only after approval")
+	chatCmd.Flags().DurationVar(&shellTimeout, "shell-timeout", 30*time.Second, "Wall-clock limit for each shell command")
+	chatCmd.Flags().IntVar(&shellCPU, "shell-cpu", 10, "CPU seconds limit for each shell command")
+	chatCmd.Flags().IntVar(&shellMaxOutput, "shell-max-output", 64*1024, "Bytes of stdout and stderr returned to the model")
 	chatCmd.AddCommand(serverCmd)
 	rootCmd.AddCommand(chatCmd)
 }
 
 func NewChatClient(c chatClient, token string) *chatClient {
-	c.client = openai.NewClient(token)
+	c.client = newOpenAIClient(token)
+	c.lookupConfig = newAPIConfigWith(token, &lookupPolicy)
 	c.history = []openai.ChatCompletionMessage{
 		{Role: "system",
 			Content: c.systemDirective,
@@ -68,11 +138,30 @@ func NewChatClient(c chatClient, token string) *chatClient {
 		c.loadPersona(c.persona)
 	}
 
+	if c.tools == nil {
+		c.tools = tools.NewRegistry()
+	}
+
+	moderation, err := loadModerationConfig(conf.moderationFile)
+	if err != nil {
+		// Running unmoderated could expose content the config was meant to stop.
+		log.Fatalf("Unable to load moderation config: %s", err)
+	}
+	c.moderation = moderation
+
 	// Initialize command registry with beta access for testing
 	c.cmdRegistry = commands.NewCommandRegistry(commands.AccessBeta)
 	return &c
 }
 
+// fork returns a client with the same settings and API client but a fresh
+// history, so independent requests can run concurrently.
+func (c *chatClient) fork() *chatClient {
+	f := *c
+	f.history = []openai.ChatCompletionMessage{{Role: "system", Content: c.systemDirective}}
+	return &f
+}
+
 func (c *chatClient) listPersonas() []string {
 	personas := []string{}
 	files, err := os.ReadDir(conf.personasDir)
@@ -113,22 +202,192 @@ func (c *chatClient) loadPersona(name string) error {
 	return nil
 }
 
-func (c *chatClient) chatRequest(input string) (string, error) {
+func (c *chatClient) chatRequest(ctx context.Context, input string) (string, error) {
+	response, err := c.chatCompletion(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
+func (c *chatClient) newRequest(stream bool) openai.ChatCompletionRequest {
+	request := openai.ChatCompletionRequest{
+		Model:       c.model,
+		Messages:    c.history,
+		Temperature: c.temperature,
+		MaxTokens:   c.maxTokens,
+		Stream:      stream,
+	}
+	if stream {
+		request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if c.tools != nil && c.tools.Len() > 0 {
+		request.Tools = c.tools.Definitions()
+	}
+	return request
+}
+
+// chatCompletion sends input as a user message and returns the full API
+// response, so callers that need usage or finish reasons can get at them.
+// Tool calls requested by the model are run until it gives a final answer;
+// the returned usage covers all of those rounds.
+func (c *chatClient) chatCompletion(ctx context.Context, input string) (openai.ChatCompletionResponse, error) {
+	if err := c.moderate(ctx, stageInput, c.composeInput(input)); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	retrieved, err := c.retrieve(ctx, input)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	start := len(c.history)
 	c.history = append(c.history, openai.ChatCompletionMessage{
 		Role:    "user",
-		Content: input,
+		Content: c.composeInput(retrieved + input),
 	})
-	request := openai.ChatCompletionRequest{
-		Model:    c.model,
-		Messages: c.history,
-		Stream:   false,
+	defer c.consumeAttachments(start)
+	defer c.dropRetrieved(start, retrieved)
+
+	var usage openai.Usage
+	for round := 0; ; round++ {
+		response, err := c.client.CreateChatCompletion(ctx, c.newRequest(false))
+		if err == nil && len(response.Choices) == 0 {
+			err = fmt.Errorf("no choices returned by model %s", c.model)
+		}
+		if err == nil && round >= maxToolRounds && len(response.Choices[0].Message.ToolCalls) > 0 {
+			err = fmt.Errorf("model still requesting tools after %d rounds", maxToolRounds)
+		}
+		if err != nil {
+			// Drop the unanswered exchange so a retry does not send it twice.
+			c.history = c.history[:start]
+			return response, err
+		}
+		addUsage(&usage, response.Usage)
+		addUsage(&c.usage, response.Usage)
+
+		msg := response.Choices[0].Message
+		if len(msg.ToolCalls) == 0 {
+			if err := c.moderate(ctx, stageOutput, msg.Content); err != nil {
+				c.history = c.history[:start]
+				return response, err
+			}
+		}
+		c.history = append(c.history, msg)
+		if len(msg.ToolCalls) == 0 {
+			response.Usage = usage
+			return response, nil
+		}
+		c.runToolCalls(ctx, msg.ToolCalls)
 	}
-	response, err := c.client.CreateChatCompletion(context.Background(), request)
+}
+
+// chatStream sends input as a user message and writes the reply to w as it
+// arrives. If ctx is cancelled part way through, the partial reply is kept
+// in the history marked as interrupted and returned with the context error.
+// When output moderation blocks, the reply is held back until it has been
+// checked. The text of every round is checked, including rounds that end
+// in tool calls, since it is all written to w.
+func (c *chatClient) chatStream(ctx context.Context, input string, w io.Writer) (string, error) {
+	c.codeReply = 0
+	if err := c.moderate(ctx, stageInput, c.composeInput(input)); err != nil {
+		return "", err
+	}
+	retrieved, err := c.retrieve(ctx, input)
 	if err != nil {
 		return "", err
 	}
-	c.history = append(c.history, response.Choices[0].Message)
-	return response.Choices[0].Message.Content, nil
+	start := len(c.history)
+	c.history = append(c.history, openai.ChatCompletionMessage{
+		Role:    "user",
+		Content: c.composeInput(retrieved + input),
+	})
+	defer c.consumeAttachments(start)
+	defer c.dropRetrieved(start, retrieved)
+
+	out := w
+	var held bytes.Buffer
+	if c.moderationPolicy().mode(stageOutput) == moderationBlock {
+		out = &held
+	}
+
+	var written strings.Builder
+	for round := 0; ; round++ {
+		msg, err := c.streamMessage(ctx, out)
+		written.WriteString(msg.Content)
+		if err != nil {
+			if out == &held || ctx.Err() == nil && msg.Content == "" {
+				// Unchecked partial replies are not kept when output is moderated.
+				c.history = c.history[:start]
+				return "", err
+			}
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			msg.Content += interruptedMarker
+			msg.ToolCalls = nil
+			c.history = append(c.history, msg)
+			return msg.Content, err
+		}
+
+		if len(msg.ToolCalls) == 0 {
+			if err := c.moderate(ctx, stageOutput, written.String()); err != nil {
+				c.history = c.history[:start]
+				return "", err
+			}
+			if _, err := held.WriteTo(w); err != nil {
+				return "", err
+			}
+			c.history = append(c.history, msg)
+			return msg.Content, nil
+		}
+		c.history = append(c.history, msg)
+		if round >= maxToolRounds {
+			c.history = c.history[:start]
+			return "", fmt.Errorf("model still requesting tools after %d rounds", maxToolRounds)
+		}
+		c.runToolCalls(ctx, msg.ToolCalls)
+	}
+}
+
+// streamMessage streams one assistant message, writing content to w and
+// assembling any tool calls from their fragments.
+func (c *chatClient) streamMessage(ctx context.Context, w io.Writer) (openai.ChatCompletionMessage, error) {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	stream, err := c.client.CreateChatCompletionStream(ctx, c.newRequest(true))
+	if err != nil {
+		return msg, err
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			msg.Content = content.String()
+			return msg, err
+		}
+		if chunk.Usage != nil {
+			addUsage(&c.usage, *chunk.Usage)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		content.WriteString(delta.Content)
+		fmt.Fprint(w, delta.Content)
+		msg.ToolCalls = mergeToolCallDeltas(msg.ToolCalls, delta.ToolCalls)
+	}
+	msg.Content = content.String()
+	return msg, nil
+}
+
+// addUsage adds the token counts in u to total.
+func addUsage(total *openai.Usage, u openai.Usage) {
+	total.PromptTokens += u.PromptTokens
+	total.CompletionTokens += u.CompletionTokens
+	total.TotalTokens += u.TotalTokens
 }
 
 func (c *chatClient) setDirective(directive string) error {
@@ -149,11 +408,7 @@ func (c *chatClient) saveConversation(name string) error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(file, conv, 0644); err != nil {
-		return err
-	}
-	c.persona = name
-	return nil
+	return os.WriteFile(file, conv, 0644)
 }
 
 func (c *chatClient) listConversations() []string {
@@ -163,6 +418,9 @@ func (c *chatClient) listConversations() []string {
 		log.Printf("error getting personas: %s", err.Error())
 	}
 	for _, f := range files {
+		if f.IsDir() {
+			continue // audio saved by /tts
+		}
 		conversations = append(conversations, f.Name())
 	}
 	return conversations
@@ -175,8 +433,15 @@ func (c *chatClient) loadConversation(name string) error {
 		return err
 	}
 
-	c.history[0].Content = string(b)
-	c.persona = name
+	var history []openai.ChatCompletionMessage
+	if err := json.Unmarshal(b, &history); err != nil {
+		return fmt.Errorf("invalid conversation file: %w", err)
+	}
+	if len(history) == 0 || history[0].Role != openai.ChatMessageRoleSystem {
+		return errors.New("invalid conversation file: missing system message")
+	}
+	c.history = history
+	c.systemDirective = history[0].Content
 	return nil
 }
 
@@ -184,39 +449,93 @@ func (c *chatClient) clearHistory() {
 	c.history = []openai.ChatCompletionMessage{{Role: "system", Content: c.systemDirective}}
 }
 
-func (c *chatClient) listModels() []string {
+func (c *chatClient) listModels(ctx context.Context) ([]string, error) {
 	mod := []string{}
-	models, err := c.client.ListModels(context.Background())
+	models, err := c.client.ListModels(ctx)
 	if err != nil {
-		fmt.Println(err.Error())
-		return mod
+		return nil, err
 	}
 	for _, m := range models.Models {
 		mod = append(mod, m.ID)
 	}
-	return mod
+	// Fine-tuned models can take a while to appear in the model list, and
+	// keys limited to some models may never see them there. Keys that cannot
+	// list fine-tuning jobs, or answer slowly, just get the model list.
+	tuned, _ := fineTunedModels(ctx, c.lookupConfig)
+	for _, m := range tuned {
+		if !containsString(mod, m) {
+			mod = append(mod, m)
+		}
+	}
+	return mod, nil
 }
 
 func interactive(c *chatClient) {
 	fmt.Printf(`Welcome to Chat with OpenAI
 Model: %s
 Persona: %s
+Type /multi for multi-line input, """ to start a block or /edit to use $EDITOR
+Press Tab to complete commands and Ctrl-R to search input history
 `, c.model, c.persona)
-	rl, err := readline.New("> ")
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:            "> ",
+		Stdin:             readline.NewCancelableStdin(newPasteFilter(os.Stdin)),
+		AutoComplete:      newCompleter(c),
+		HistoryFile:       conf.historyFile,
+		HistorySearchFold: true,
+	})
 	if err != nil {
 		panic(err)
 	}
 	defer rl.Close()
+	defer enableBracketedPaste()()
+	in := &inputReader{rl: rl, prompt: "> "}
+	c.confirm = confirmWith(rl)
+	c.copyText = func(text string) error {
+		_, err := fmt.Fprint(os.Stdout, osc52(text))
+		return err
+	}
+
+	if err := enableFilesystemTools(c, c.confirm); err != nil {
+		fmt.Printf("\033[31mError: %s\033[0m\n", err)
+		return
+	}
+	if err := enableShellTool(c, c.confirm); err != nil {
+		fmt.Printf("\033[31mError: %s\033[0m\n", err)
+		return
+	}
+	if fsRoot != "" {
+		policy := "writes need approval"
+		if fsYes {
+			policy = "writes allowed"
+		}
+		fmt.Printf("Files: %s (%s)\n", fsRoot, policy)
+	}
 
 	for {
 		fmt.Printf("%d > ", len(c.history))
-		line, err := rl.Readline()
-		if err != nil { // io.EOF
+		line, err := in.next()
+		if err == readline.ErrInterrupt {
+			fmt.Println("(use /q or Ctrl-D to quit)")
+			continue
+		}
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			fmt.Printf("\033[31mError: %s\033[0m\n", err)
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		// Ctrl-C while a command or request runs cancels only that call.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 
 		if strings.HasPrefix(line, "/") {
-			resp := c.cmdRegistry.ExecuteCommand(c, line)
+			resp := c.cmdRegistry.ExecuteCommand(ctx, c, line)
+			stop()
 			if resp == "" {
 				continue
 			}
@@ -239,11 +558,27 @@ Persona: %s
 			continue
 		}
 
-		r, err := c.chatRequest(line)
+		out := newReplyWriter(os.Stdout)
+		c.onToolCall = func(call openai.ToolCall, result string, err error) {
+			out.Flush()
+			printToolCall(call, result, err)
+		}
+		c.onRetrieve = printSources
+		c.onModeration = printModeration
+		reply, err := c.chatStream(ctx, line, out)
+		out.Flush()
+		fmt.Println()
+		if err == nil {
+			err = c.announceSpeech(ctx, reply, os.Stdout)
+		}
+		stop()
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("\033[33mRequest cancelled\033[0m")
+			continue
+		}
 		if err != nil {
-			log.Println(err.Error())
+			fmt.Printf("\033[31mError: %s\033[0m\n", err)
 		}
-		fmt.Println(r)
 	}
 }
 
@@ -272,8 +607,8 @@ func (c *chatClient) ClearHistory() {
 	c.clearHistory()
 }
 
-func (c *chatClient) ListModels() []string {
-	return c.listModels()
+func (c *chatClient) ListModels(ctx context.Context) ([]string, error) {
+	return c.listModels(ctx)
 }
 
 func (c *chatClient) SetModel(model string) {
@@ -281,7 +616,11 @@ func (c *chatClient) SetModel(model string) {
 }
 
 func (c *chatClient) SaveConversation(name string) error {
-	return c.saveConversation(name)
+	if err := c.saveConversation(name); err != nil {
+		return err
+	}
+	c.conversation = name
+	return nil
 }
 
 func (c *chatClient) ListConversations() []string {
@@ -289,7 +628,11 @@ func (c *chatClient) ListConversations() []string {
 }
 
 func (c *chatClient) LoadConversation(name string) error {
-	return c.loadConversation(name)
+	if err := c.loadConversation(name); err != nil {
+		return err
+	}
+	c.conversation = name
+	return nil
 }
 
 func (c *chatClient) GetCurrentPersona() string {
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hmm01i/openai/pkg/markdown"
+	"github.com/hmm01i/openai/pkg/tools"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// snippetShells maps the fence languages that /code run accepts to the shell
+// that runs them.
+var snippetShells = map[string]string{
+	"sh":    "sh",
+	"shell": "sh",
+	"bash":  "bash",
+	"zsh":   "zsh",
+}
+
+// replies returns the assistant replies in the history, oldest first.
+func (c *chatClient) replies() []string {
+	var replies []string
+	for _, m := range c.history {
+		if m.Role == openai.ChatMessageRoleAssistant && m.Content != "" {
+			replies = append(replies, m.Content)
+		}
+	}
+	return replies
+}
+
+// codeBlocks returns the code blocks of the reply selected with /code list,
+// or of the latest reply, along with the reply's number.
+func (c *chatClient) codeBlocks() ([]markdown.CodeBlock, int, error) {
+	replies := c.replies()
+	if len(replies) == 0 {
+		return nil, 0, errors.New("no replies yet")
+	}
+	n := c.codeReply
+	if n == 0 {
+		n = len(replies)
+	}
+	if n < 1 || n > len(replies) {
+		return nil, 0, fmt.Errorf("reply %d does not exist (there are %d)", n, len(replies))
+	}
+	return markdown.CodeBlocks(replies[n-1]), n, nil
+}
+
+// codeBlock returns block n (1-based) of the selected reply.
+func (c *chatClient) codeBlock(n int) (markdown.CodeBlock, error) {
+	blocks, reply, err := c.codeBlocks()
+	if err != nil {
+		return markdown.CodeBlock{}, err
+	}
+	if n < 1 || n > len(blocks) {
+		return markdown.CodeBlock{}, fmt.Errorf("reply %d has no code block %d (use /code list)", reply, n)
+	}
+	return blocks[n-1], nil
+}
+
+// runSnippet runs a shell code block after the user confirms it, with the
+// same limits and audit log as the run_command tool, returning its output
+// and exit status.
+func (c *chatClient) runSnippet(ctx context.Context, block markdown.CodeBlock) (string, error) {
+	program, ok := snippetShells[block.Lang]
+	if !ok {
+		return "", fmt.Errorf("only shell snippets can be run, this one is %q", block.Lang)
+	}
+	if c.confirm == nil {
+		return "", errors.New("running snippets needs an interactive session")
+	}
+	config, err := shellConfig()
+	if err != nil {
+		return "", err
+	}
+	shell, err := tools.NewShell(config, c.confirm)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := shell.Run(ctx, program, block.Code,
+		fmt.Sprintf("%sRun this %s snippet in %s?", block.Code, program, config.Dir))
+	if errors.Is(err, tools.ErrDeclined) {
+		return "", errors.New("not run")
+	}
+	if err != nil {
+		return "", err
+	}
+	var result string
+	for _, out := range []string{res.Stdout, res.Stderr} {
+		if out = strings.TrimRight(out, "\n"); out != "" {
+			result += out + "\n"
+		}
+	}
+	if res.Warning != "" {
+		result += "Warning: " + res.Warning + "\n"
+	}
+	if res.Error != "" {
+		return result, fmt.Errorf("snippet stopped: %s", res.Error)
+	}
+	return result + fmt.Sprintf("[exit status %d]", res.ExitCode), nil
+}
+
+// osc52 returns the escape sequence that asks the terminal to put text on
+// the system clipboard, wrapped for tmux when running inside it.
+func osc52(text string) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if os.Getenv("TMUX") != "" {
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq
+}
+
+func (c *chatClient) ListCodeBlocks(reply int) ([]string, error) {
+	c.codeReply = reply
+	blocks, n, err := c.codeBlocks()
+	if err != nil {
+		c.codeReply = 0
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return []string{fmt.Sprintf("Reply %d has no code blocks", n)}, nil
+	}
+	list := []string{fmt.Sprintf("Reply %d:", n)}
+	for i, b := range blocks {
+		lang := b.Lang
+		if lang == "" {
+			lang = "text"
+		}
+		first, _, _ := strings.Cut(strings.TrimSpace(b.Code), "\n")
+		if r := []rune(first); len(r) > 60 {
+			first = string(r[:57]) + "..."
+		}
+		lines := fmt.Sprintf("%d lines", strings.Count(b.Code, "\n"))
+		if lines == "1 lines" {
+			lines = "1 line"
+		}
+		list = append(list, fmt.Sprintf("  %d. %s, %s: %s", i+1, lang, lines, first))
+	}
+	return list, nil
+}
+
+// SaveCodeBlock writes block n to path. Saving needs someone to confirm
+// overwriting a file, so it is refused where nobody can, as on the server.
+func (c *chatClient) SaveCodeBlock(n int, path string) error {
+	if c.confirm == nil {
+		return errors.New("saving code blocks needs an interactive session")
+	}
+	block, err := c.codeBlock(n)
+	if err != nil {
+		return err
+	}
+	file, err := c.hostPath(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(file); err == nil && !c.confirm(fmt.Sprintf("Overwrite %s?", file)) {
+		return errors.New("not saved")
+	}
+	return os.WriteFile(file, []byte(block.Code), 0644)
+}
+
+func (c *chatClient) CopyCodeBlock(n int) error {
+	if c.copyText == nil {
+		return errors.New("copying needs a terminal")
+	}
+	block, err := c.codeBlock(n)
+	if err != nil {
+		return err
+	}
+	return c.copyText(block.Code)
+}
+
+func (c *chatClient) RunCodeBlock(ctx context.Context, n int) (string, error) {
+	block, err := c.codeBlock(n)
+	if err != nil {
+		return "", err
+	}
+	return c.runSnippet(ctx, block)
+}
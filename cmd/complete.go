@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/hmm01i/openai/pkg/commands"
+)
+
+// completionTTL is how long completions fetched from the API, such as the
+// model list, are reused before being fetched again.
+const completionTTL = time.Minute
+
+// replCommands are handled by the input reader rather than the registry.
+var replCommands = []string{"/multi", "/edit"}
+
+// newCompleter builds tab completion from the command registry, completing
+// arguments such as persona, conversation and model names dynamically.
+func newCompleter(c *chatClient) *readline.PrefixCompleter {
+	cmds := c.cmdRegistry.Commands()
+	var items []readline.PrefixCompleterInterface
+	for _, name := range sortedCommandNames(cmds) {
+		cmd := cmds[name]
+		var children []readline.PrefixCompleterInterface
+		for _, sub := range sortedCommandNames(cmd.SubCmds) {
+			children = append(children, readline.PcItem(sub, argCompleter(c, cmd.SubCmds[sub])...))
+		}
+		children = append(children, argCompleter(c, cmd)...)
+		items = append(items, readline.PcItem(name, children...))
+	}
+	for _, name := range replCommands {
+		items = append(items, readline.PcItem(name))
+	}
+	return readline.NewPrefixCompleter(items...)
+}
+
+func sortedCommandNames(cmds map[string]*commands.Command) []string {
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// argCompleter returns a dynamic completion item for the command's argument.
+// Local candidates, such as saved conversations, are read on every Tab so
+// new ones show up at once; those from the API are cached for completionTTL.
+func argCompleter(c *chatClient, cmd *commands.Command) []readline.PrefixCompleterInterface {
+	if cmd.Complete == nil {
+		return nil
+	}
+	var (
+		mu      sync.Mutex
+		cached  []string
+		fetched time.Time
+	)
+	return []readline.PrefixCompleterInterface{
+		readline.PcItemDynamic(func(string) []string {
+			mu.Lock()
+			defer mu.Unlock()
+			if !cmd.CompleteRemote || time.Since(fetched) > completionTTL {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				cached = cmd.Complete(ctx, c)
+				sort.Strings(cached)
+				fetched = time.Now()
+			}
+			return cached
+		}),
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hmm01i/openai/pkg/finetune"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var (
+	datasetOutput string
+	datasetAll    bool
+)
+
+var finetuneDatasetCmd = &cobra.Command{
+	Use:   "dataset <conversation>...",
+	Short: "Builds a training file from saved conversations",
+	Long: `This command writes each saved conversation as one training example, in the
+chat format used for fine-tuning. Names may be patterns such as "support-*";
+--all takes every saved conversation. The file is validated once written.
+
+Tool calls and their results are left out, since training on them needs the
+tool definitions. Replies marked [interrupted] are kept as context but given
+weight 0, so the model does not learn from them. Conversations with no
+complete reply are skipped.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names, err := selectConversations(chatC.listConversations(), args, datasetAll)
+		if err != nil {
+			return &exitError{exitUsage, err}
+		}
+
+		var out bytes.Buffer
+		written := 0
+		for _, name := range names {
+			c := chatC.fork()
+			if err := c.loadConversation(name); err != nil {
+				return &exitError{exitFailure, fmt.Errorf("%s: %w", name, err)}
+			}
+			example, ok := conversationExample(c.history)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Skipped %s: no complete reply to learn from\n", name)
+				continue
+			}
+			b, err := json.Marshal(example)
+			if err != nil {
+				return &exitError{exitFailure, err}
+			}
+			out.Write(append(b, '\n'))
+			written++
+		}
+		if written == 0 {
+			return &exitError{exitFailure, fmt.Errorf("none of the %d conversations has a reply to learn from", len(names))}
+		}
+		if err := os.WriteFile(datasetOutput, out.Bytes(), 0644); err != nil {
+			return &exitError{exitFailure, err}
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d examples to %s\n", written, datasetOutput)
+
+		report, err := finetune.Validate(&out, finetune.Limits{MinExamples: finetune.MinExamples})
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		printTrainingReport(os.Stderr, datasetOutput, report)
+		return nil
+	},
+}
+
+func init() {
+	finetuneDatasetCmd.Flags().StringVarP(&datasetOutput, "output", "o", "training.jsonl", "Training file to write")
+	finetuneDatasetCmd.Flags().BoolVar(&datasetAll, "all", false, "Use every saved conversation")
+	finetuneCmd.AddCommand(finetuneDatasetCmd)
+}
+
+// selectConversations returns the saved conversations matching the names
+// or patterns, in the order given and without repeats.
+func selectConversations(saved, patterns []string, all bool) ([]string, error) {
+	if all {
+		if len(patterns) > 0 {
+			return nil, fmt.Errorf("give conversation names or --all, not both")
+		}
+		if len(saved) == 0 {
+			return nil, fmt.Errorf("no saved conversations in %s", conf.conversationDir)
+		}
+		return saved, nil
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("give the conversations to use, or --all")
+	}
+	var names []string
+	for _, p := range patterns {
+		matched := false
+		for _, name := range saved {
+			if ok, err := filepath.Match(p, name); err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+			} else if ok {
+				matched = true
+				if !containsString(names, name) {
+					names = append(names, name)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no saved conversation matches %s", p)
+		}
+	}
+	return names, nil
+}
+
+// conversationExample turns a conversation's history into a training
+// example. It reports false if no reply is left to learn from.
+func conversationExample(history []openai.ChatCompletionMessage) (finetune.Example, bool) {
+	var example finetune.Example
+	learnable := false
+	for _, m := range history {
+		if m.Role == openai.ChatMessageRoleTool || strings.TrimSpace(m.Content) == "" {
+			continue // tool results, and requests for tools with no text
+		}
+		msg := finetune.Message{Role: m.Role, Content: m.Content}
+		if m.Role == openai.ChatMessageRoleAssistant {
+			if strings.HasSuffix(m.Content, interruptedMarker) {
+				zero := 0
+				msg.Weight = &zero
+			} else {
+				learnable = true
+			}
+		}
+		example.Messages = append(example.Messages, msg)
+	}
+	return example, learnable
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hmm01i/openai/pkg/textfile"
+	"github.com/hmm01i/openai/pkg/vecindex"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// embedBatchSize is how many chunks are embedded per API request.
+	embedBatchSize = 64
+	// maxIndexedFile is the largest file "oai index add" reads.
+	maxIndexedFile = 1 << 20
+	// minChunkSize is the smallest --chunk-size accepted; smaller chunks
+	// carry too little text to be found by a search.
+	minChunkSize = 100
+)
+
+var (
+	indexName  string
+	embedModel string
+	chunkSize  int
+	embedFiles []string
+	embedPrint bool
+	indexTopK  int
+	indexJSON  bool
+)
+
+var embedCmd = &cobra.Command{
+	Use:   "embed [text]...",
+	Short: "Computes embeddings for text or files and stores them in an index",
+	Long: `This command embeds each text argument and each --file, splitting files into
+chunks, and stores the results in a local index under ~/.openai/index. Files
+already in the index are re-embedded only when they have changed.
+
+With --print the embeddings are printed as JSON lines instead of stored.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && len(embedFiles) == 0 {
+			return &exitError{exitUsage, errors.New("give text to embed or --file")}
+		}
+		if err := checkChunkSize(); err != nil {
+			return &exitError{exitUsage, err}
+		}
+		client := newOpenAIClient(getAPIToken())
+		if embedPrint {
+			return printEmbeddings(cmd.Context(), client, args)
+		}
+
+		ix, err := openIndex(indexName, modelFlag(cmd))
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		for _, text := range args {
+			hash := contentHash([]byte(text))
+			if _, err := indexText(cmd.Context(), client, ix, "text:"+hash, text, hash); err != nil {
+				return &exitError{exitFailure, err}
+			}
+		}
+		for _, file := range embedFiles {
+			n, err := indexFile(cmd.Context(), client, ix, file)
+			if err != nil {
+				return &exitError{exitFailure, err}
+			}
+			reportIndexed(file, n)
+		}
+		if err := ix.Save(); err != nil {
+			return &exitError{exitFailure, err}
+		}
+		fmt.Printf("Index %s: %d chunks from %d sources\n", indexName, len(ix.Chunks), len(ix.Sources()))
+		return nil
+	},
+}
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manages local embedding indexes",
+	Long: `Indexes live under ~/.openai/index, one directory each, and are searched by
+cosine similarity. They are used by "oai index query", "oai ask --index" and
+/rag in chat.`,
+}
+
+var indexAddCmd = &cobra.Command{
+	Use:   "add <dir>...",
+	Short: "Indexes the text files in directories",
+	Long: `This command walks each directory, splits every text file into chunks and stores
+their embeddings in the index. Hidden files and directories, binary files and
+files over 1 MB are skipped. Unchanged files are not re-embedded, and files
+that have been deleted are dropped from the index.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkChunkSize(); err != nil {
+			return &exitError{exitUsage, err}
+		}
+		ix, err := openIndex(indexName, modelFlag(cmd))
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		client := newOpenAIClient(getAPIToken())
+		for _, dir := range args {
+			if err := indexDir(cmd.Context(), client, ix, dir); err != nil {
+				ix.Save() // keep what was embedded before the failure
+				return &exitError{exitFailure, err}
+			}
+		}
+		if err := ix.Save(); err != nil {
+			return &exitError{exitFailure, err}
+		}
+		fmt.Printf("Index %s: %d chunks from %d sources\n", indexName, len(ix.Chunks), len(ix.Sources()))
+		return nil
+	},
+}
+
+var indexQueryCmd = &cobra.Command{
+	Use:           "query <text>",
+	Short:         "Finds the chunks most similar to a query",
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		results, err := searchIndex(cmd.Context(), newOpenAIClient(getAPIToken()), indexName, strings.Join(args, " "), indexTopK)
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		if indexJSON {
+			type result struct {
+				Source    string  `json:"source"`
+				StartLine int     `json:"start_line,omitempty"`
+				EndLine   int     `json:"end_line,omitempty"`
+				Score     float32 `json:"score"`
+				Text      string  `json:"text"`
+			}
+			out := []result{}
+			for _, r := range results {
+				out = append(out, result{r.Source, r.StartLine, r.EndLine, r.Score, r.Text})
+			}
+			return printJSON(out)
+		}
+		for i, r := range results {
+			fmt.Printf("%d. %.3f %s\n", i+1, r.Score, chunkCitation(r.Chunk))
+			for _, line := range strings.Split(previewText(r.Text, 3), "\n") {
+				fmt.Printf("   %s\n", line)
+			}
+		}
+		return nil
+	},
+}
+
+var indexListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "Lists the local indexes",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, name := range listIndexes() {
+			ix, err := vecindex.Open(filepath.Join(conf.indexDir, name))
+			if err != nil {
+				fmt.Printf("%s: %s\n", name, err)
+				continue
+			}
+			fmt.Printf("%s: %d chunks from %d sources, %s, updated %s\n", name, len(ix.Chunks),
+				len(ix.Sources()), ix.Model, ix.Updated.Local().Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+func init() {
+	embedCmd.Flags().StringArrayVarP(&embedFiles, "file", "f", nil, "File to embed (repeatable)")
+	embedCmd.Flags().BoolVar(&embedPrint, "print", false, "Print the embeddings as JSON lines instead of storing them")
+	for _, cmd := range []*cobra.Command{embedCmd, indexAddCmd} {
+		cmd.Flags().StringVarP(&embedModel, "model", "m", string(openai.SmallEmbedding3), "Embedding model; existing indexes keep theirs")
+		cmd.Flags().IntVar(&chunkSize, "chunk-size", 1500, "Approximate chunk size in bytes")
+	}
+	for _, cmd := range []*cobra.Command{embedCmd, indexAddCmd, indexQueryCmd} {
+		cmd.Flags().StringVarP(&indexName, "index", "i", "default", "Name of the index")
+	}
+	indexQueryCmd.Flags().IntVarP(&indexTopK, "top", "k", 5, "Number of chunks to return")
+	indexQueryCmd.Flags().BoolVar(&indexJSON, "json", false, "Print the results as JSON")
+
+	indexCmd.AddCommand(indexAddCmd, indexQueryCmd, indexListCmd)
+	rootCmd.AddCommand(embedCmd, indexCmd)
+}
+
+func checkChunkSize() error {
+	if chunkSize < minChunkSize {
+		return fmt.Errorf("--chunk-size must be at least %d", minChunkSize)
+	}
+	return nil
+}
+
+// listIndexes returns the names of the saved indexes.
+func listIndexes() []string {
+	var names []string
+	entries, err := os.ReadDir(conf.indexDir)
+	if err != nil {
+		log.Printf("error listing indexes: %s", err.Error())
+	}
+	for _, e := range entries {
+		if e.IsDir() && vecindex.Exists(filepath.Join(conf.indexDir, e.Name())) {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// openIndex opens the named index, checking that it was built with model
+// if one is given. An index that does not exist yet adopts model, or the
+// default embedding model.
+func openIndex(name, model string) (*vecindex.Index, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid index name: %q", name)
+	}
+	ix, err := vecindex.Open(filepath.Join(conf.indexDir, name))
+	if err != nil {
+		return nil, err
+	}
+	if ix.Model == "" {
+		ix.Model = model
+		if model == "" {
+			ix.Model = string(openai.SmallEmbedding3)
+		}
+	}
+	if model != "" && ix.Model != model {
+		return nil, fmt.Errorf("index %s uses %s, not %s", name, ix.Model, model)
+	}
+	return ix, nil
+}
+
+// modelFlag returns the --model given to cmd, or "" when it was left at
+// its default so an existing index keeps its own model.
+func modelFlag(cmd *cobra.Command) string {
+	if cmd.Flags().Changed("model") {
+		return embedModel
+	}
+	return ""
+}
+
+// searchIndex embeds query with the index's model and returns the k most
+// similar chunks.
+func searchIndex(ctx context.Context, client *openai.Client, name, query string, k int) ([]vecindex.Result, error) {
+	if !vecindex.Exists(filepath.Join(conf.indexDir, name)) {
+		return nil, fmt.Errorf("no index named %s; create it with oai index add", name)
+	}
+	ix, err := openIndex(name, "")
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := embedTexts(ctx, client, ix.Model, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return ix.Search(vectors[0], k), nil
+}
+
+// embedTexts embeds texts in batches, returning one vector per text.
+func embedTexts(ctx context.Context, client *openai.Client, model string, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		resp, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+			Input: texts[start:end],
+			Model: openai.EmbeddingModel(model),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("embedding failed: %w", err)
+		}
+		if len(resp.Data) != end-start {
+			return nil, fmt.Errorf("embedding failed: got %d vectors for %d inputs", len(resp.Data), end-start)
+		}
+		sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Index < resp.Data[j].Index })
+		for _, d := range resp.Data {
+			vectors = append(vectors, d.Embedding)
+		}
+	}
+	return vectors, nil
+}
+
+// indexText splits text into chunks, embeds them and stores them in ix as
+// source, unless source is already there with the same hash. It returns the
+// number of chunks embedded.
+func indexText(ctx context.Context, client *openai.Client, ix *vecindex.Index, source, text, hash string) (int, error) {
+	if hash != "" && ix.SourceHash(source) == hash {
+		return 0, nil
+	}
+	pieces := vecindex.Split(text, chunkSize)
+	texts := make([]string, len(pieces))
+	for i, p := range pieces {
+		texts[i] = p.Text
+	}
+	vectors, err := embedTexts(ctx, client, ix.Model, texts)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", source, err)
+	}
+	chunks := make([]vecindex.Chunk, len(pieces))
+	for i, p := range pieces {
+		chunks[i] = vecindex.Chunk{
+			Source:    source,
+			Hash:      hash,
+			StartLine: p.StartLine,
+			EndLine:   p.EndLine,
+			Text:      p.Text,
+			Vector:    vectors[i],
+		}
+	}
+	return len(chunks), ix.Replace(source, chunks)
+}
+
+// indexFile indexes one text file under its absolute path.
+func indexFile(ctx context.Context, client *openai.Client, ix *vecindex.Index, file string) (int, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return 0, err
+	}
+	b, err := os.ReadFile(abs)
+	if err != nil {
+		return 0, err
+	}
+	if textfile.IsBinary(b) {
+		return 0, fmt.Errorf("%s is not a text file", file)
+	}
+	return indexText(ctx, client, ix, abs, string(b), contentHash(b))
+}
+
+// indexDir indexes the text files under dir and drops files under it that
+// no longer exist.
+func indexDir(ctx context.Context, client *openai.Client, ix *vecindex.Index, dir string) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxIndexedFile || info.Size() == 0 {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if textfile.IsBinary(b) {
+			return nil
+		}
+		seen[path] = true
+		n, err := indexText(ctx, client, ix, path, string(b), contentHash(b))
+		if err != nil {
+			return err
+		}
+		reportIndexed(path, n)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	prefix := root + string(filepath.Separator)
+	for source := range ix.Sources() {
+		if strings.HasPrefix(source, prefix) && !seen[source] {
+			ix.Replace(source, nil)
+			fmt.Printf("Removed %s\n", displayPath(source))
+		}
+	}
+	return nil
+}
+
+func reportIndexed(path string, chunks int) {
+	switch {
+	case chunks == 1:
+		fmt.Printf("Indexed %s (1 chunk)\n", displayPath(path))
+	case chunks > 1:
+		fmt.Printf("Indexed %s (%d chunks)\n", displayPath(path), chunks)
+	}
+}
+
+// printEmbeddings prints one JSON object per text with its embedding.
+func printEmbeddings(ctx context.Context, client *openai.Client, texts []string) error {
+	for _, file := range embedFiles {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		texts = append(texts, string(b))
+	}
+	vectors, err := embedTexts(ctx, client, embedModel, texts)
+	if err != nil {
+		return &exitError{exitFailure, err}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for i, v := range vectors {
+		enc.Encode(struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}{i, v})
+	}
+	return nil
+}
+
+func contentHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// chunkCitation names a chunk by its source and line range.
+func chunkCitation(c vecindex.Chunk) string {
+	if strings.HasPrefix(c.Source, "text:") || c.StartLine == 0 {
+		return displayPath(c.Source)
+	}
+	return fmt.Sprintf("%s:%d-%d", displayPath(c.Source), c.StartLine, c.EndLine)
+}
+
+// displayPath shortens paths under the working directory.
+func displayPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// previewText returns the first n non-blank lines of text.
+func previewText(text string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if r := []rune(line); len(r) > 100 {
+			line = string(r[:97]) + "..."
+		}
+		lines = append(lines, line)
+		if len(lines) == n {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hmm01i/openai/pkg/fakeapi"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fakeAPIAddr        string
+	fakeAPIStreamDelay time.Duration
+)
+
+var fakeAPICmd = &cobra.Command{
+	Use:   "fakeapi",
+	Short: "Starts a local stand-in for the OpenAI API",
+	Long: `This command starts an in-memory fake of the OpenAI API for local testing.
+Chat completions echo the last user message, and batch jobs advance one step
+each time their status is polled. Point other commands at it with:
+
+  export OPENAI_BASE_URL=http://localhost:8081/v1`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Printf("Fake OpenAI API listening on %s", fakeAPIAddr)
+		server := fakeapi.NewServer()
+		server.StreamDelay = fakeAPIStreamDelay
+		return http.ListenAndServe(fakeAPIAddr, server.Handler())
+	},
+}
+
+func init() {
+	fakeAPICmd.Flags().StringVar(&fakeAPIAddr, "addr", "localhost:8081", "Address to listen on")
+	fakeAPICmd.Flags().DurationVar(&fakeAPIStreamDelay, "stream-delay", 0, "Pause between streamed chunks")
+	rootCmd.AddCommand(fakeAPICmd)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hmm01i/openai/pkg/finetune"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var (
+	filesPurpose  string
+	filesJSON     bool
+	uploadPurpose string
+	uploadForce   bool
+)
+
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "Manages files uploaded to the API",
+	Long: `Uploaded files are used by fine-tuning jobs, the Batch API and assistants. They
+are kept until deleted and count against the organisation's storage.`,
+}
+
+var filesListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "Lists uploaded files, newest first",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := newOpenAIClient(getAPIToken()).ListFiles(cmd.Context())
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		var files []openai.File
+		for _, f := range list.Files {
+			if filesPurpose == "" || f.Purpose == filesPurpose {
+				files = append(files, f)
+			}
+		}
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].CreatedAt > files[j].CreatedAt
+		})
+		if filesJSON {
+			if files == nil {
+				files = []openai.File{}
+			}
+			return printJSON(files)
+		}
+		for _, f := range files {
+			fmt.Printf("%s  %-17s %9s  %s  %s\n", f.ID, f.Purpose, formatBytes(f.Bytes),
+				time.Unix(f.CreatedAt, 0).Format("2006-01-02 15:04"), f.FileName)
+		}
+		return nil
+	},
+}
+
+var filesUploadCmd = &cobra.Command{
+	Use:   "upload <file>",
+	Short: "Uploads a file and prints its id",
+	Long: `This command uploads a file for the given purpose and prints its id. Training
+files for fine-tuning are checked first with the same rules as "oai finetune
+validate", and are not uploaded if they have problems unless --force is given.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if uploadPurpose == string(openai.PurposeFineTune) {
+			limits := finetune.Limits{MinExamples: finetune.MinExamples}
+			if err := checkTrainingFile(args[0], limits, uploadForce); err != nil {
+				return err
+			}
+		}
+		file, err := uploadFile(cmd.Context(), newOpenAIClient(getAPIToken()), args[0], uploadPurpose)
+		if err != nil {
+			return err
+		}
+		fmt.Println(file.ID)
+		return nil
+	},
+}
+
+var filesDeleteCmd = &cobra.Command{
+	Use:           "delete <file-id>...",
+	Short:         "Deletes uploaded files",
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := newOpenAIClient(getAPIToken())
+		for _, id := range args {
+			if err := client.DeleteFile(cmd.Context(), id); err != nil {
+				return &exitError{exitFailure, fmt.Errorf("deleting %s: %w", id, err)}
+			}
+			fmt.Printf("Deleted %s\n", id)
+		}
+		return nil
+	},
+}
+
+func init() {
+	filesListCmd.Flags().StringVar(&filesPurpose, "purpose", "", "Only list files with this purpose, such as fine-tune or batch")
+	filesListCmd.Flags().BoolVar(&filesJSON, "json", false, "Print the files as JSON")
+	filesUploadCmd.Flags().StringVar(&uploadPurpose, "purpose", string(openai.PurposeFineTune), "Purpose: fine-tune, batch or assistants")
+	filesUploadCmd.Flags().BoolVar(&uploadForce, "force", false, "Upload a training file even if validation finds problems")
+	filesCmd.AddCommand(filesListCmd)
+	filesCmd.AddCommand(filesUploadCmd)
+	filesCmd.AddCommand(filesDeleteCmd)
+	rootCmd.AddCommand(filesCmd)
+}
+
+// uploadFile uploads path for purpose.
+func uploadFile(ctx context.Context, client *openai.Client, path, purpose string) (openai.File, error) {
+	if _, err := os.Stat(path); err != nil {
+		return openai.File{}, &exitError{exitUsage, err}
+	}
+	file, err := client.CreateFile(ctx, openai.FileRequest{FilePath: path, Purpose: purpose})
+	if err != nil {
+		return openai.File{}, &exitError{exitFailure, fmt.Errorf("upload failed: %w", err)}
+	}
+	return file, nil
+}
+
+// formatBytes prints a size in B, KB or MB.
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hmm01i/openai/pkg/finetune"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// defaultFineTuneModel is the base model fine-tuned when --model is not given.
+const defaultFineTuneModel = "gpt-4o-mini-2024-07-18"
+
+var (
+	ftMaxTokens      int
+	ftModel          string
+	ftValidationFile string
+	ftSuffix         string
+	ftEpochs         int
+	ftForce          bool
+	ftWait           bool
+	ftPollInterval   time.Duration
+	ftLimit          int
+	ftJSON           bool
+)
+
+var finetuneCmd = &cobra.Command{
+	Use:   "finetune",
+	Short: "Manages fine-tuning jobs",
+	Long: `Fine-tuning trains a copy of a model on example conversations. Build a training
+file with "oai finetune dataset", check it with "oai finetune validate" and start
+a job with "oai finetune create". Models from jobs that succeed are listed by
+/model list in chat.`,
+}
+
+var finetuneValidateCmd = &cobra.Command{
+	Use:   "validate <file.jsonl>...",
+	Short: "Checks training files without uploading them",
+	Long: `This command checks that every line of a chat training file is a JSON object with
+a list of messages in known roles and at least one assistant reply, and that no
+example is longer than --max-tokens. It also estimates the tokens in each example
+and the tokens billed for training. Estimates assume about four characters per
+token.
+
+The exit status is 1 when any file has problems.`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		failed := 0
+		for _, path := range args {
+			report, err := validateTrainingFile(path, finetune.Limits{MaxTokens: ftMaxTokens, MinExamples: finetune.MinExamples})
+			if err != nil {
+				return &exitError{exitFailure, err}
+			}
+			printTrainingReport(os.Stdout, path, report)
+			if len(report.Problems) > 0 {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return &exitError{exitFailure, fmt.Errorf("%d of %d files have problems", failed, len(args))}
+		}
+		return nil
+	},
+}
+
+var finetuneCreateCmd = &cobra.Command{
+	Use:   "create <training-file>",
+	Short: "Starts a fine-tuning job",
+	Long: `This command starts a fine-tuning job and prints its id. The training file, and
+the file given with --validation-file, can be local JSONL files, which are
+validated and uploaded first, or the ids of files already uploaded.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		client := newOpenAIClient(getAPIToken())
+		training, err := fineTuneFileID(ctx, client, args[0], finetune.MinExamples)
+		if err != nil {
+			return err
+		}
+		req := openai.FineTuningJobRequest{TrainingFile: training, Model: ftModel, Suffix: ftSuffix}
+		if ftValidationFile != "" {
+			if req.ValidationFile, err = fineTuneFileID(ctx, client, ftValidationFile, 0); err != nil {
+				return err
+			}
+		}
+		if ftEpochs > 0 {
+			req.Hyperparameters = &openai.Hyperparameters{Epochs: ftEpochs}
+		}
+		job, err := client.CreateFineTuningJob(ctx, req)
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		fmt.Println(job.ID)
+		if ftWait {
+			if _, err := fineTuningStatus(ctx, client, job.ID); err != nil {
+				return &exitError{exitFailure, err}
+			}
+		}
+		return nil
+	},
+}
+
+var finetuneListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "Lists recent fine-tuning jobs, newest first",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, err := listFineTuningJobs(cmd.Context(), newAPIConfig(getAPIToken()), ftLimit)
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		if ftJSON {
+			return printJSON(jobs)
+		}
+		for _, job := range jobs {
+			printFineTuningJob(job)
+		}
+		return nil
+	},
+}
+
+var finetuneStatusCmd = &cobra.Command{
+	Use:           "status <job-id>",
+	Short:         "Shows the status of a fine-tuning job",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := newOpenAIClient(getAPIToken())
+		if ftJSON {
+			job, err := client.RetrieveFineTuningJob(cmd.Context(), args[0])
+			if err != nil {
+				return &exitError{exitFailure, err}
+			}
+			return printJSON(job)
+		}
+		if _, err := fineTuningStatus(cmd.Context(), client, args[0]); err != nil {
+			return &exitError{exitFailure, err}
+		}
+		return nil
+	},
+}
+
+var finetuneCancelCmd = &cobra.Command{
+	Use:           "cancel <job-id>",
+	Short:         "Cancels a fine-tuning job",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		job, err := newOpenAIClient(getAPIToken()).CancelFineTuningJob(cmd.Context(), args[0])
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		printFineTuningJob(job)
+		return nil
+	},
+}
+
+var finetuneEventsCmd = &cobra.Command{
+	Use:           "events <job-id>",
+	Short:         "Shows the latest events of a fine-tuning job, oldest first",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		events, err := newOpenAIClient(getAPIToken()).ListFineTuningJobEvents(cmd.Context(), args[0],
+			openai.ListFineTuningJobEventsWithLimit(ftLimit))
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		if ftJSON {
+			return printJSON(events.Data)
+		}
+		// The API returns the newest event first.
+		for i := len(events.Data) - 1; i >= 0; i-- {
+			e := events.Data[i]
+			fmt.Printf("%s  %-5s  %s\n", time.Unix(e.CreatedAt, 0).Format("2006-01-02 15:04:05"), e.Level, e.Message)
+		}
+		return nil
+	},
+}
+
+func init() {
+	finetuneValidateCmd.Flags().IntVar(&ftMaxTokens, "max-tokens", finetune.DefaultMaxTokens, "Longest example in tokens before it is truncated")
+	finetuneCreateCmd.Flags().StringVarP(&ftModel, "model", "m", defaultFineTuneModel, "Base model to fine-tune")
+	finetuneCreateCmd.Flags().StringVar(&ftValidationFile, "validation-file", "", "Validation file, local or uploaded")
+	finetuneCreateCmd.Flags().StringVar(&ftSuffix, "suffix", "", "Text added to the fine-tuned model's name")
+	finetuneCreateCmd.Flags().IntVar(&ftEpochs, "epochs", 0, "Training epochs (0 lets the API choose)")
+	finetuneCreateCmd.Flags().BoolVar(&ftForce, "force", false, "Upload local files even if validation finds problems")
+	finetuneCreateCmd.Flags().BoolVarP(&ftWait, "wait", "w", false, "Poll until the job reaches a final state")
+	finetuneCreateCmd.Flags().DurationVar(&ftPollInterval, "interval", 30*time.Second, "Polling interval used with --wait")
+	finetuneListCmd.Flags().IntVarP(&ftLimit, "limit", "l", 20, "Number of jobs to list")
+	finetuneListCmd.Flags().BoolVar(&ftJSON, "json", false, "Print the jobs as JSON")
+	finetuneStatusCmd.Flags().BoolVarP(&ftWait, "wait", "w", false, "Poll until the job reaches a final state")
+	finetuneStatusCmd.Flags().DurationVar(&ftPollInterval, "interval", 30*time.Second, "Polling interval used with --wait")
+	finetuneStatusCmd.Flags().BoolVar(&ftJSON, "json", false, "Print the job as JSON")
+	finetuneEventsCmd.Flags().IntVarP(&ftLimit, "limit", "l", 20, "Number of events to show")
+	finetuneEventsCmd.Flags().BoolVar(&ftJSON, "json", false, "Print the events as JSON")
+
+	finetuneCmd.AddCommand(finetuneValidateCmd)
+	finetuneCmd.AddCommand(finetuneCreateCmd)
+	finetuneCmd.AddCommand(finetuneListCmd)
+	finetuneCmd.AddCommand(finetuneStatusCmd)
+	finetuneCmd.AddCommand(finetuneCancelCmd)
+	finetuneCmd.AddCommand(finetuneEventsCmd)
+	rootCmd.AddCommand(finetuneCmd)
+}
+
+func validateTrainingFile(path string, limits finetune.Limits) (*finetune.Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return finetune.Validate(f, limits)
+}
+
+// checkTrainingFile validates a file before it is uploaded for fine-tuning,
+// reporting on stderr, and refuses it if it has problems unless force is
+// set.
+func checkTrainingFile(path string, limits finetune.Limits, force bool) error {
+	report, err := validateTrainingFile(path, limits)
+	if err != nil {
+		return &exitError{exitUsage, err}
+	}
+	printTrainingReport(os.Stderr, path, report)
+	if len(report.Problems) > 0 && !force {
+		return &exitError{exitFailure, fmt.Errorf("not uploading %s with problems; fix them or use --force", path)}
+	}
+	return nil
+}
+
+func printTrainingReport(w io.Writer, path string, r *finetune.Report) {
+	fmt.Fprintf(w, "%s: %d examples\n", path, r.Examples)
+	if len(r.Tokens) > 0 {
+		shortest, median, longest := r.TokenRange()
+		epochs := finetune.Epochs(r.Examples)
+		fmt.Fprintf(w, "  Tokens per example: %d shortest, %d median, %d longest (estimated)\n", shortest, median, longest)
+		fmt.Fprintf(w, "  About %d tokens billed for training over %d epochs\n", r.BilledTokens(epochs), epochs)
+	}
+	if len(r.Problems) == 0 {
+		fmt.Fprintln(w, "  No problems found")
+		return
+	}
+	fmt.Fprintf(w, "  %d problems:\n", len(r.Problems))
+	for _, p := range r.Problems {
+		fmt.Fprintf(w, "    %s\n", p)
+	}
+}
+
+// fineTuneFileID returns the id of the file to train with. A local file is
+// validated and uploaded; anything else is taken to be an uploaded file's id.
+func fineTuneFileID(ctx context.Context, client *openai.Client, arg string, minExamples int) (string, error) {
+	if _, err := os.Stat(arg); err != nil {
+		if strings.HasPrefix(arg, "file-") {
+			return arg, nil
+		}
+		return "", &exitError{exitUsage, err}
+	}
+	if err := checkTrainingFile(arg, finetune.Limits{MinExamples: minExamples}, ftForce); err != nil {
+		return "", err
+	}
+	file, err := uploadFile(ctx, client, arg, string(openai.PurposeFineTune))
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "Uploaded %s as %s\n", arg, file.ID)
+	return file.ID, nil
+}
+
+func printFineTuningJob(job openai.FineTuningJob) {
+	fmt.Printf("%s: %s (%s", job.ID, job.Status, job.Model)
+	if job.FineTunedModel != "" {
+		fmt.Printf(" -> %s", job.FineTunedModel)
+	}
+	fmt.Print(")")
+	if job.TrainedTokens > 0 {
+		fmt.Printf(", %d tokens trained", job.TrainedTokens)
+	}
+	fmt.Println()
+}
+
+func fineTuningFinished(status string) bool {
+	switch status {
+	case "succeeded", "failed", "cancelled":
+		return true
+	}
+	return false
+}
+
+// fineTuningStatus prints the status of a job, polling until it finishes
+// when --wait is set.
+func fineTuningStatus(ctx context.Context, client *openai.Client, id string) (openai.FineTuningJob, error) {
+	for {
+		job, err := client.RetrieveFineTuningJob(ctx, id)
+		if err != nil {
+			return openai.FineTuningJob{}, err
+		}
+		printFineTuningJob(job)
+		if !ftWait || fineTuningFinished(job.Status) {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(ftPollInterval):
+		}
+	}
+}
+
+// listFineTuningJobs lists the most recent fine-tuning jobs. The client
+// library has no call for this endpoint, so it is requested directly.
+func listFineTuningJobs(ctx context.Context, config openai.ClientConfig, limit int) ([]openai.FineTuningJob, error) {
+	url := fmt.Sprintf("%s/fine_tuning/jobs?limit=%d", config.BaseURL, limit)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e openai.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != nil {
+			e.Error.HTTPStatusCode = resp.StatusCode
+			return nil, e.Error
+		}
+		return nil, fmt.Errorf("listing fine-tuning jobs failed: %s", resp.Status)
+	}
+	var list struct {
+		Data []openai.FineTuningJob `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid list of fine-tuning jobs: %w", err)
+	}
+	if list.Data == nil {
+		list.Data = []openai.FineTuningJob{}
+	}
+	return list.Data, nil
+}
+
+// fineTunedModels returns the models made by recent jobs that succeeded.
+func fineTunedModels(ctx context.Context, config openai.ClientConfig) ([]string, error) {
+	jobs, err := listFineTuningJobs(ctx, config, 100)
+	if err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, job := range jobs {
+		if job.Status == "succeeded" && job.FineTunedModel != "" {
+			models = append(models, job.FineTunedModel)
+		}
+	}
+	return models, nil
+}
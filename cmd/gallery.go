@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+var galleryLimit int
+
+// galleryEntry is the sidecar JSON kept next to every image in the gallery,
+// recording how the image was made.
+type galleryEntry struct {
+	ID            string    `json:"id"`
+	File          string    `json:"file"`
+	Prompt        string    `json:"prompt,omitempty"`
+	RevisedPrompt string    `json:"revised_prompt,omitempty"`
+	Source        string    `json:"source,omitempty"`
+	Model         string    `json:"model"`
+	Size          string    `json:"size"`
+	Quality       string    `json:"quality,omitempty"`
+	Style         string    `json:"style,omitempty"`
+	Created       time.Time `json:"created"`
+}
+
+var imageListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "List images in the gallery, newest first",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := loadGallery()
+		if err != nil {
+			return err
+		}
+		return printGallery(entries)
+	},
+}
+
+var imageShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show how a gallery image was made",
+	Long: `This command prints the prompt, settings and file of a gallery image. The id
+may be shortened to any unique prefix.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		e, err := findGalleryEntry(args[0])
+		if err != nil {
+			return err
+		}
+		if imageJSON {
+			return printJSON(e)
+		}
+		fmt.Printf("ID:       %s\n", e.ID)
+		fmt.Printf("File:     %s\n", e.File)
+		fmt.Printf("Created:  %s\n", e.Created.Local().Format(time.RFC1123))
+		fmt.Printf("Model:    %s\n", e.Model)
+		fmt.Printf("Size:     %s\n", e.Size)
+		if e.Quality != "" {
+			fmt.Printf("Quality:  %s\n", e.Quality)
+		}
+		if e.Style != "" {
+			fmt.Printf("Style:    %s\n", e.Style)
+		}
+		if e.Source != "" {
+			fmt.Printf("Source:   %s\n", e.Source)
+		}
+		if e.Prompt != "" {
+			fmt.Printf("Prompt:   %s\n", e.Prompt)
+		}
+		if e.RevisedPrompt != "" {
+			fmt.Printf("Revised:  %s\n", e.RevisedPrompt)
+		}
+		return nil
+	},
+}
+
+var imageSearchCmd = &cobra.Command{
+	Use:           "search <words>...",
+	Short:         "Find gallery images whose prompt contains all the given words",
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := loadGallery()
+		if err != nil {
+			return err
+		}
+		var matches []galleryEntry
+		for _, e := range entries {
+			if e.matches(args) {
+				matches = append(matches, e)
+			}
+		}
+		return printGallery(matches)
+	},
+}
+
+func init() {
+	imageListCmd.Flags().IntVarP(&galleryLimit, "limit", "l", 20, "Show at most this many images (0 for all)")
+	imageListCmd.Flags().BoolVar(&imageJSON, "json", false, "Print the entries as JSON")
+	imageShowCmd.Flags().BoolVar(&imageJSON, "json", false, "Print the entry as JSON")
+	imageSearchCmd.Flags().IntVarP(&galleryLimit, "limit", "l", 20, "Show at most this many images (0 for all)")
+	imageSearchCmd.Flags().BoolVar(&imageJSON, "json", false, "Print the entries as JSON")
+
+	imageCmd.AddCommand(imageListCmd, imageShowCmd, imageSearchCmd)
+}
+
+// addToGallery saves an image and its sidecar in the gallery directory,
+// named after the time it was created.
+func addToGallery(b []byte, m imageManifest, revisedPrompt string) (galleryEntry, error) {
+	model := m.Model
+	if model == "" {
+		model = openai.CreateImageModelDallE2
+	}
+	e := galleryEntry{
+		Prompt:        m.Prompt,
+		RevisedPrompt: revisedPrompt,
+		Source:        m.Source,
+		Model:         model,
+		Size:          m.Size,
+		Quality:       m.Quality,
+		Style:         m.Style,
+		Created:       m.Created,
+	}
+
+	stamp := m.Created.Local().Format("20060102-150405")
+	for i := 1; ; i++ {
+		e.ID = fmt.Sprintf("%s-%d", stamp, i)
+		e.File = galleryFile(e.ID)
+		if _, err := os.Stat(e.File); os.IsNotExist(err) {
+			break
+		}
+	}
+	if err := savePNG(b, e.File); err != nil {
+		return e, err
+	}
+	sidecar, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return e, err
+	}
+	return e, os.WriteFile(strings.TrimSuffix(e.File, ".png")+".json", sidecar, 0644)
+}
+
+// galleryFile returns the path of the gallery image with the given id.
+func galleryFile(id string) string {
+	return filepath.Join(conf.imageSaveDir, id+".png")
+}
+
+// loadGallery reads every sidecar in the gallery, newest first.
+func loadGallery() ([]galleryEntry, error) {
+	files, err := filepath.Glob(filepath.Join(conf.imageSaveDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var entries []galleryEntry
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var e galleryEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			log.Printf("skipping %s: %s", f, err.Error())
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Created.Equal(entries[j].Created) {
+			return entries[i].Created.After(entries[j].Created)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	return entries, nil
+}
+
+// findGalleryEntry returns the gallery entry whose id is, or uniquely
+// starts with, id.
+func findGalleryEntry(id string) (galleryEntry, error) {
+	entries, err := loadGallery()
+	if err != nil {
+		return galleryEntry{}, err
+	}
+	var found []galleryEntry
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+		if strings.HasPrefix(e.ID, id) {
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return galleryEntry{}, fmt.Errorf("no image %s in the gallery", id)
+	case 1:
+		return found[0], nil
+	}
+	return galleryEntry{}, fmt.Errorf("%s matches %d images; give more of the id", id, len(found))
+}
+
+// matches reports whether every word occurs in the entry's prompts or
+// source, ignoring case.
+func (e galleryEntry) matches(words []string) bool {
+	text := strings.ToLower(e.Prompt + "\n" + e.RevisedPrompt + "\n" + e.Source)
+	for _, w := range words {
+		if !strings.Contains(text, strings.ToLower(w)) {
+			return false
+		}
+	}
+	return true
+}
+
+func printGallery(entries []galleryEntry) error {
+	if galleryLimit > 0 && len(entries) > galleryLimit {
+		entries = entries[:galleryLimit]
+	}
+	if imageJSON {
+		if entries == nil {
+			entries = []galleryEntry{}
+		}
+		return printJSON(entries)
+	}
+	for _, e := range entries {
+		desc := e.Prompt
+		if desc == "" {
+			desc = "variation of " + e.Source
+		}
+		if r := []rune(desc); len(r) > 60 {
+			desc = string(r[:57]) + "..."
+		}
+		fmt.Printf("%s  %-9s %-9s %s\n", e.ID, e.Model, e.Size, desc)
+	}
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -4,10 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"image"
 	"image/png"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/hmm01i/openai/pkg/imgconv"
+	"github.com/hmm01i/openai/pkg/retry"
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
@@ -15,69 +24,379 @@ import (
 var (
 	output string
 	prompt string
+
+	imageOpts = imageOptions{
+		Size:           openai.CreateImageSize256x256,
+		N:              1,
+		ResponseFormat: openai.CreateImageResponseFormatB64JSON,
+	}
+	imageJSON bool
+	imageOut  = imageOutput{JPEGQuality: 90}
 )
 
+// imageOutput controls how images are written to the output file. The
+// gallery always keeps the PNG the API returned.
+type imageOutput struct {
+	Format      string // png or jpeg; inferred from the file extension when empty
+	JPEGQuality int
+	Resize      int // fit the image in a box this many pixels wide and high
+	Thumbnail   int // also write a thumbnail this many pixels across
+}
+
+// imageOptions are the generation parameters sent to the images API.
+type imageOptions struct {
+	Model          string
+	Size           string
+	Quality        string
+	Style          string
+	ResponseFormat string
+	N              int
+}
+
+// imageSizes lists the sizes each model accepts.
+var imageSizes = map[string][]string{
+	openai.CreateImageModelDallE2:    {openai.CreateImageSize256x256, openai.CreateImageSize512x512, openai.CreateImageSize1024x1024},
+	openai.CreateImageModelDallE3:    {openai.CreateImageSize1024x1024, openai.CreateImageSize1792x1024, openai.CreateImageSize1024x1792},
+	openai.CreateImageModelGptImage1: {openai.CreateImageSize1024x1024, openai.CreateImageSize1536x1024, openai.CreateImageSize1024x1536},
+}
+
+// validate checks the options against what the chosen model supports. An
+// empty model is the API default, dall-e-2.
+func (o imageOptions) validate() error {
+	model := o.Model
+	if model == "" {
+		model = openai.CreateImageModelDallE2
+	}
+	if sizes, ok := imageSizes[model]; ok && !containsString(sizes, o.Size) {
+		return fmt.Errorf("%s supports sizes %s", model, strings.Join(sizes, ", "))
+	}
+	if o.N < 1 || o.N > 10 {
+		return fmt.Errorf("number of images must be between 1 and 10")
+	}
+	if model == openai.CreateImageModelDallE3 && o.N != 1 {
+		return fmt.Errorf("%s generates one image per request", model)
+	}
+	if o.Style != "" && model != openai.CreateImageModelDallE3 {
+		return fmt.Errorf("--style is only supported by %s", openai.CreateImageModelDallE3)
+	}
+	switch o.ResponseFormat {
+	case openai.CreateImageResponseFormatB64JSON, openai.CreateImageResponseFormatURL:
+	default:
+		return fmt.Errorf("response format must be %s or %s", openai.CreateImageResponseFormatB64JSON, openai.CreateImageResponseFormatURL)
+	}
+	if model == openai.CreateImageModelGptImage1 && o.ResponseFormat == openai.CreateImageResponseFormatURL {
+		return fmt.Errorf("%s only returns image data, not URLs", model)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// imageManifest describes a generation request and the images it produced.
+// It is the --json output of the image command.
+type imageManifest struct {
+	Prompt  string           `json:"prompt,omitempty"`
+	Source  string           `json:"source,omitempty"`
+	Mask    string           `json:"mask,omitempty"`
+	Model   string           `json:"model,omitempty"`
+	Size    string           `json:"size"`
+	Quality string           `json:"quality,omitempty"`
+	Style   string           `json:"style,omitempty"`
+	Created time.Time        `json:"created"`
+	Images  []generatedImage `json:"images"`
+}
+
+// generatedImage is one image from a generation request.
+type generatedImage struct {
+	File          string `json:"file,omitempty"`
+	URL           string `json:"url,omitempty"`
+	Gallery       string `json:"gallery,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
 var imageCmd = &cobra.Command{
 	Use:   "image",
 	Short: "Generates an image based on a prompt",
-	Long:  `This command generates an image based on the provided prompt and saves it to the specified output file.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		imageRequest(prompt, output)
+	Long: `This command generates images based on the provided prompt and saves them to
+the specified output file. When more than one image is requested they are
+numbered: -o out.png -n 2 writes out-1.png and out-2.png.
+
+Every image is also kept in the gallery (~/.openai/images) with a JSON file
+recording its prompt and settings; see "oai image list". Without --output the
+gallery copy is the only one.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkImageOutput(); err != nil {
+			return err
+		}
+		client := newOpenAIClient(getAPIToken())
+		manifest, err := imageRequest(cmd.Context(), client, prompt, imageOpts, output)
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		return printImageManifest(manifest)
 	},
 }
 
 func init() {
 	conf.initConfigs()
-	imageCmd.Flags().StringVarP(&output, "output", "o", "", "Output file for the generated image (required)")
 	imageCmd.Flags().StringVarP(&prompt, "prompt", "p", "", "Prompt for generating the image (required)")
-	imageCmd.MarkFlagRequired("output")
+	imageCmd.Flags().StringVarP(&imageOpts.Model, "model", "m", "", "Image model: dall-e-2 (default), dall-e-3 or gpt-image-1")
+	imageCmd.Flags().StringVar(&imageOpts.Quality, "quality", "", "Image quality: standard or hd (dall-e-3), low, medium or high (gpt-image-1)")
+	imageCmd.Flags().StringVar(&imageOpts.Style, "style", "", "Image style for dall-e-3: vivid or natural")
+	addImageOutputFlags(imageCmd)
 	imageCmd.MarkFlagRequired("prompt")
 	rootCmd.AddCommand(imageCmd)
 }
 
-func imageRequest(prompt string, outputFile string) error {
-	ic := openai.NewClient(getAPIToken())
-	ctx := context.Background()
-	// Example image as base64
-	reqBase64 := openai.ImageRequest{
-		Prompt:         prompt,
-		Size:           openai.CreateImageSize256x256,
-		ResponseFormat: openai.CreateImageResponseFormatB64JSON,
-		N:              1,
+// addImageOutputFlags adds the flags shared by every command that produces
+// images.
+func addImageOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file for the generated image, in addition to the gallery copy; - for stdout")
+	cmd.Flags().StringVarP(&imageOpts.Size, "size", "s", imageOpts.Size, "Image size, such as 256x256, 512x512, 1024x1024 or 1792x1024")
+	cmd.Flags().IntVarP(&imageOpts.N, "number", "n", imageOpts.N, "Number of images to generate")
+	cmd.Flags().StringVar(&imageOpts.ResponseFormat, "response-format", imageOpts.ResponseFormat, "How the API returns images: b64_json or url")
+	cmd.Flags().BoolVar(&imageJSON, "json", false, "Print a JSON manifest of the generated images")
+	cmd.Flags().StringVarP(&imageOut.Format, "format", "f", "", "Output format: png or jpeg (default from the --output extension, else png)")
+	cmd.Flags().IntVar(&imageOut.JPEGQuality, "jpeg-quality", imageOut.JPEGQuality, "JPEG quality from 1 to 100")
+	cmd.Flags().IntVar(&imageOut.Resize, "resize", 0, "Scale the output to fit in a box this many pixels across")
+	cmd.Flags().IntVar(&imageOut.Thumbnail, "thumbnail", 0, "Also write a thumbnail this many pixels across, named <output>-thumb")
+}
+
+// checkImageOutput validates the options shared by the image commands.
+func checkImageOutput() error {
+	if err := imageOpts.validate(); err != nil {
+		return &exitError{exitUsage, err}
+	}
+	if err := imageOut.validate(output, imageOpts.N); err != nil {
+		return &exitError{exitUsage, err}
 	}
+	return nil
+}
 
-	respBase64, err := ic.CreateImage(ctx, reqBase64)
+// validate checks the output options and settles the format for file.
+func (o *imageOutput) validate(file string, n int) error {
+	var err error
+	if o.Format != "" {
+		o.Format, err = imgconv.ParseFormat(o.Format)
+	} else if file != "-" {
+		o.Format, err = imgconv.FormatFromExt(file)
+	}
 	if err != nil {
-		fmt.Printf("Image creation error: %v\n", err)
 		return err
 	}
+	if o.Format == "" {
+		o.Format = imgconv.PNG
+	}
+	if o.JPEGQuality < 1 || o.JPEGQuality > 100 {
+		return fmt.Errorf("JPEG quality must be between 1 and 100")
+	}
+	if o.Resize < 0 || o.Thumbnail < 0 {
+		return fmt.Errorf("--resize and --thumbnail take a size in pixels")
+	}
+	if file == "-" && n > 1 {
+		return fmt.Errorf("only one image can be written to standard output")
+	}
+	if file == "-" && o.Thumbnail > 0 {
+		return fmt.Errorf("--thumbnail needs an output file")
+	}
+	return nil
+}
+
+// numberedFileNames returns the files n outputs are saved to: output itself
+// for a single one, else output with -1, -2, ... before the extension.
+func numberedFileNames(output string, n int) []string {
+	if output == "" {
+		return make([]string, n)
+	}
+	if n == 1 {
+		return []string{output}
+	}
+	ext := filepath.Ext(output)
+	base := strings.TrimSuffix(output, ext)
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d%s", base, i+1, ext)
+	}
+	return names
+}
 
-	imgBytes, err := base64.StdEncoding.DecodeString(respBase64.Data[0].B64JSON)
+// imageRequest generates images for prompt and saves them to the gallery
+// and under outputFile, if one is given.
+func imageRequest(ctx context.Context, ic *openai.Client, prompt string, opts imageOptions, outputFile string) (imageManifest, error) {
+	req := openai.ImageRequest{
+		Prompt:  prompt,
+		Model:   opts.Model,
+		Size:    opts.Size,
+		Quality: opts.Quality,
+		Style:   opts.Style,
+		N:       opts.N,
+	}
+	if opts.Model != openai.CreateImageModelGptImage1 {
+		req.ResponseFormat = opts.ResponseFormat
+	}
+
+	manifest := imageManifest{
+		Prompt:  prompt,
+		Model:   opts.Model,
+		Size:    opts.Size,
+		Quality: opts.Quality,
+		Style:   opts.Style,
+		Created: time.Now(),
+	}
+	resp, err := ic.CreateImage(ctx, req)
 	if err != nil {
-		fmt.Printf("Base64 decode error: %v\n", err)
-		return err
+		return manifest, fmt.Errorf("image creation failed: %w", err)
 	}
+	return manifest, saveImages(ctx, resp, &manifest, outputFile)
+}
+
+// saveImages saves the images in resp to the gallery and under outputFile,
+// and records them in the manifest.
+func saveImages(ctx context.Context, resp openai.ImageResponse, manifest *imageManifest, outputFile string) error {
+	if resp.Created != 0 {
+		manifest.Created = time.Unix(resp.Created, 0)
+	}
+	files := numberedFileNames(outputFile, len(resp.Data))
+	for i, data := range resp.Data {
+		img := generatedImage{URL: data.URL, RevisedPrompt: data.RevisedPrompt}
+		b, err := imageData(ctx, data)
+		if err != nil {
+			return err
+		}
+		if files[i] != "" {
+			if err := writeImage(b, files[i]); err != nil {
+				return err
+			}
+			img.File = files[i]
+		}
+		entry, err := addToGallery(b, *manifest, data.RevisedPrompt)
+		if err != nil {
+			return fmt.Errorf("saving to gallery: %w", err)
+		}
+		img.Gallery = entry.ID
+		manifest.Images = append(manifest.Images, img)
+	}
+	return nil
+}
 
-	r := bytes.NewReader(imgBytes)
-	imgData, err := png.Decode(r)
+// imageData returns the bytes of a generated image, downloading it when the
+// API returned a URL. The download follows the API retry policy, including
+// its timeout, but is sent without the API token.
+func imageData(ctx context.Context, data openai.ImageResponseDataInner) ([]byte, error) {
+	if data.URL == "" {
+		b, err := base64.StdEncoding.DecodeString(data.B64JSON)
+		if err != nil {
+			return nil, fmt.Errorf("base64 decode error: %w", err)
+		}
+		return b, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, data.URL, nil)
 	if err != nil {
-		fmt.Printf("PNG decode error: %v\n", err)
-		return err
+		return nil, err
+	}
+	resp, err := retry.NewClient(&apiPolicy).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("image download failed: %w", err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image download failed: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
 
-	file, err := os.Create(outputFile)
+// writeImage writes a PNG returned by the API to file, or to stdout for
+// "-", converted and scaled as the output options ask.
+func writeImage(b []byte, file string) error {
+	img, err := png.Decode(bytes.NewReader(b))
 	if err != nil {
-		fmt.Printf("File creation error: %v\n", err)
+		return fmt.Errorf("PNG decode error: %w", err)
+	}
+	if imageOut.Resize > 0 {
+		img = imgconv.Thumbnail(img, imageOut.Resize)
+	}
+	if file == "-" {
+		return imgconv.Encode(os.Stdout, img, imageOut.Format, imageOut.JPEGQuality)
+	}
+	if err := encodeImageFile(img, file); err != nil {
 		return err
 	}
-	defer file.Close()
+	if imageOut.Thumbnail > 0 {
+		ext := filepath.Ext(file)
+		thumb := strings.TrimSuffix(file, ext) + "-thumb" + ext
+		return encodeImageFile(imgconv.Thumbnail(img, imageOut.Thumbnail), thumb)
+	}
+	return nil
+}
 
-	if err := png.Encode(file, imgData); err != nil {
-		fmt.Printf("PNG encode error: %v\n", err)
-		return err
+func encodeImageFile(img image.Image, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("file creation error: %w", err)
+	}
+	defer f.Close()
+	if err := imgconv.Encode(f, img, imageOut.Format, imageOut.JPEGQuality); err != nil {
+		return fmt.Errorf("%s encode error: %w", imageOut.Format, err)
 	}
+	return f.Close()
+}
 
-	fmt.Printf("The image was saved as %s", outputFile)
+// savePNG decodes a PNG image and writes it to file.
+func savePNG(b []byte, file string) error {
+	imgData, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("PNG decode error: %w", err)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("file creation error: %w", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, imgData); err != nil {
+		return fmt.Errorf("PNG encode error: %w", err)
+	}
+	return f.Close()
+}
 
+// printImageManifest reports the saved images, on stderr when the image
+// itself went to stdout.
+func printImageManifest(m imageManifest) error {
+	w := io.Writer(os.Stdout)
+	if output == "-" {
+		w = os.Stderr
+	}
+	if imageJSON {
+		out, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		fmt.Fprintln(w, string(out))
+		return nil
+	}
+	for _, img := range m.Images {
+		switch {
+		case img.File == "-":
+			fmt.Fprintf(w, "The image was written to standard output (gallery %s)\n", img.Gallery)
+		case img.File != "":
+			fmt.Fprintf(w, "The image was saved as %s (gallery %s)\n", img.File, img.Gallery)
+		case img.URL != "":
+			fmt.Fprintf(w, "%s (gallery %s)\n", img.URL, img.Gallery)
+		default:
+			fmt.Fprintf(w, "The image was saved to the gallery as %s\n", img.Gallery)
+		}
+		if img.RevisedPrompt != "" {
+			fmt.Fprintf(w, "  Revised prompt: %s\n", img.RevisedPrompt)
+		}
+	}
 	return nil
 }
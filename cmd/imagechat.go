@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// imageContextMessages is how many recent messages are shown to the chat
+// model when it writes an image prompt for /image.
+const imageContextMessages = 10
+
+const imagePromptDirective = `You write prompts for an image generation model. Reply with the prompt
+only: one paragraph describing the picture, with no preamble or quotes.`
+
+// GenerateImage turns request into an image prompt that draws on the
+// conversation so far, generates the image into the gallery and notes it
+// in the history.
+func (c *chatClient) GenerateImage(ctx context.Context, request string) (string, error) {
+	prompt := request
+	if transcript := c.imageContext(); transcript != "" {
+		// The request is checked before the model sees it; the prompt
+		// written from it is checked again by generateImage.
+		if err := c.moderate(ctx, stageInput, request); err != nil {
+			return "", err
+		}
+		var err error
+		prompt, err = c.writeImagePrompt(ctx, fmt.Sprintf(
+			"Conversation so far:\n%s\n\nWrite a prompt for this image, using the conversation for any details it refers to: %s",
+			transcript, request))
+		if err != nil {
+			return "", err
+		}
+	}
+	return c.generateImage(ctx, prompt)
+}
+
+// RefineImage asks the chat model to rewrite the last image prompt
+// following instructions, then generates the new image.
+func (c *chatClient) RefineImage(ctx context.Context, instructions string) (string, error) {
+	last := c.lastImagePrompt
+	if last == "" {
+		entries, err := loadGallery()
+		if err != nil {
+			return "", err
+		}
+		for _, e := range entries {
+			if e.Prompt != "" {
+				last = e.Prompt
+				break
+			}
+		}
+	}
+	if last == "" {
+		return "", errors.New("no image prompt to refine; use /image <prompt> first")
+	}
+	if err := c.moderate(ctx, stageInput, instructions); err != nil {
+		return "", err
+	}
+	prompt, err := c.writeImagePrompt(ctx, fmt.Sprintf(
+		"Rewrite this image prompt:\n%s\n\nFollow these instructions: %s", last, instructions))
+	if err != nil {
+		return "", err
+	}
+	return c.generateImage(ctx, prompt)
+}
+
+// generateImage generates one image for prompt with the image command's
+// defaults and records an assistant note about it in the history. The
+// prompt is moderated as input since it may have been written by the
+// model rather than the user.
+func (c *chatClient) generateImage(ctx context.Context, prompt string) (string, error) {
+	if err := c.moderate(ctx, stageInput, prompt); err != nil {
+		return "", err
+	}
+	manifest, err := imageRequest(ctx, c.client, prompt, imageOpts, "")
+	if err != nil {
+		return "", err
+	}
+	if len(manifest.Images) == 0 {
+		return "", errors.New("no image returned")
+	}
+	c.lastImagePrompt = prompt
+
+	img := manifest.Images[0]
+	file := galleryFile(img.Gallery)
+	note := fmt.Sprintf("[Generated an image, saved as %s, from the prompt: %s]", file, prompt)
+	c.history = append(c.history, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: note,
+	})
+
+	report := fmt.Sprintf("Image saved as %s\nPrompt: %s", file, prompt)
+	if img.RevisedPrompt != "" {
+		report += "\nRevised prompt: " + img.RevisedPrompt
+	}
+	return report, nil
+}
+
+// imageContext returns the last few user and assistant messages as a
+// transcript, or "" when the conversation has not started.
+func (c *chatClient) imageContext() string {
+	var lines []string
+	for _, m := range c.history[1:] {
+		if (m.Role == openai.ChatMessageRoleUser || m.Role == openai.ChatMessageRoleAssistant) && m.Content != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", m.Role, m.Content))
+		}
+	}
+	if len(lines) > imageContextMessages {
+		lines = lines[len(lines)-imageContextMessages:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeImagePrompt asks the chat model for an image prompt. The exchange is
+// kept out of the history.
+func (c *chatClient) writeImagePrompt(ctx context.Context, input string) (string, error) {
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: imagePromptDirective},
+			{Role: openai.ChatMessageRoleUser, Content: input},
+		},
+		Temperature: c.temperature,
+	})
+	if err != nil {
+		return "", fmt.Errorf("writing image prompt: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned by model %s", c.model)
+	}
+	addUsage(&c.usage, resp.Usage)
+	prompt := strings.Trim(strings.TrimSpace(resp.Choices[0].Message.Content), `"`)
+	if prompt == "" {
+		return "", errors.New("the model returned an empty image prompt")
+	}
+	return prompt, nil
+}
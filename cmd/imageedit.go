@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/hmm01i/openai/pkg/imgconv"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// maxImageUpload is the largest image the edits and variations API accept.
+const maxImageUpload = 4 << 20
+
+var (
+	sourceImage string
+	maskImage   string
+)
+
+var imageEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edits an image based on a prompt",
+	Long: `This command edits an image following the prompt. Transparent areas of the
+mask, or of the image itself when no mask is given, are the parts redrawn.
+
+The API needs square PNG files under 4 MB. Other formats are converted,
+non-square images are cropped to their centre and large images are scaled
+down, with a note for each change.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkImageOutput(); err != nil {
+			return err
+		}
+		img, data, err := prepareImageUpload(sourceImage)
+		if err != nil {
+			return &exitError{exitUsage, err}
+		}
+		req := openai.ImageEditRequest{
+			Image:          openai.WrapReader(bytes.NewReader(data), "image.png", "image/png"),
+			Prompt:         prompt,
+			N:              imageOpts.N,
+			Size:           imageOpts.Size,
+			ResponseFormat: imageOpts.ResponseFormat,
+		}
+		if maskImage != "" {
+			mask, err := prepareMask(maskImage, img.Bounds().Size())
+			if err != nil {
+				return &exitError{exitUsage, err}
+			}
+			req.Mask = openai.WrapReader(bytes.NewReader(mask), "mask.png", "image/png")
+		} else if !imgconv.HasTransparency(img) {
+			return &exitError{exitUsage, fmt.Errorf("%s has no transparent areas to edit; pass --mask", sourceImage)}
+		}
+
+		manifest := imageManifest{Prompt: prompt, Source: sourceImage, Mask: maskImage, Size: imageOpts.Size}
+		resp, err := newOpenAIClient(getAPIToken()).CreateEditImage(cmd.Context(), req)
+		if err != nil {
+			return &exitError{exitFailure, fmt.Errorf("image edit failed: %w", err)}
+		}
+		if err := saveImages(cmd.Context(), resp, &manifest, output); err != nil {
+			return &exitError{exitFailure, err}
+		}
+		return printImageManifest(manifest)
+	},
+}
+
+var imageVaryCmd = &cobra.Command{
+	Use:   "vary",
+	Short: "Generates variations of an image",
+	Long: `This command generates variations of an image. The input is converted to a
+square PNG under 4 MB when needed, as for "oai image edit".`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkImageOutput(); err != nil {
+			return err
+		}
+		_, data, err := prepareImageUpload(sourceImage)
+		if err != nil {
+			return &exitError{exitUsage, err}
+		}
+		req := openai.ImageVariRequest{
+			Image:          openai.WrapReader(bytes.NewReader(data), "image.png", "image/png"),
+			N:              imageOpts.N,
+			Size:           imageOpts.Size,
+			ResponseFormat: imageOpts.ResponseFormat,
+		}
+
+		manifest := imageManifest{Source: sourceImage, Size: imageOpts.Size}
+		resp, err := newOpenAIClient(getAPIToken()).CreateVariImage(cmd.Context(), req)
+		if err != nil {
+			return &exitError{exitFailure, fmt.Errorf("image variation failed: %w", err)}
+		}
+		if err := saveImages(cmd.Context(), resp, &manifest, output); err != nil {
+			return &exitError{exitFailure, err}
+		}
+		return printImageManifest(manifest)
+	},
+}
+
+func init() {
+	imageEditCmd.Flags().StringVar(&sourceImage, "image", "", "Image to edit (required)")
+	imageEditCmd.Flags().StringVar(&maskImage, "mask", "", "Mask whose transparent areas mark what to edit")
+	imageEditCmd.Flags().StringVarP(&prompt, "prompt", "p", "", "Description of the edited image (required)")
+	addImageOutputFlags(imageEditCmd)
+	imageEditCmd.MarkFlagRequired("image")
+	imageEditCmd.MarkFlagRequired("prompt")
+
+	imageVaryCmd.Flags().StringVar(&sourceImage, "image", "", "Image to vary (required)")
+	addImageOutputFlags(imageVaryCmd)
+	imageVaryCmd.MarkFlagRequired("image")
+
+	imageCmd.AddCommand(imageEditCmd, imageVaryCmd)
+}
+
+// prepareImageUpload loads an image as the edits and variations API need
+// it: a square PNG under 4 MB. It converts what it can and says so on
+// stderr.
+func prepareImageUpload(path string) (image.Image, []byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	img, format, err := imgconv.Decode(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if format == "png" && imgconv.IsSquare(img) && len(b) <= maxImageUpload {
+		return img, b, nil
+	}
+
+	if format != "png" {
+		fmt.Fprintf(os.Stderr, "Converting %s from %s to PNG\n", path, format)
+	}
+	if !imgconv.IsSquare(img) {
+		size := img.Bounds().Size()
+		img = imgconv.CropSquare(img)
+		fmt.Fprintf(os.Stderr, "Cropping %s from %dx%d to %dx%d\n", path, size.X, size.Y, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	data, err := imgconv.EncodePNG(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	for side := 1024; len(data) > maxImageUpload && side >= 256; side /= 2 {
+		if img.Bounds().Dx() <= side {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Scaling %s down to %dx%d to stay under 4 MB\n", path, side, side)
+		img = imgconv.Resize(img, side, side)
+		if data, err = imgconv.EncodePNG(img); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(data) > maxImageUpload {
+		return nil, nil, fmt.Errorf("%s is larger than 4 MB even after scaling", path)
+	}
+	return img, data, nil
+}
+
+// prepareMask loads a mask and brings it to the size of the prepared image,
+// cropping and scaling it the same way.
+func prepareMask(path string, size image.Point) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mask, _, err := imgconv.Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !imgconv.HasTransparency(mask) {
+		return nil, fmt.Errorf("%s has no transparent areas, so nothing would be edited", path)
+	}
+	if !imgconv.IsSquare(mask) {
+		mask = imgconv.CropSquare(mask)
+	}
+	if mask.Bounds().Size() != size {
+		mask = imgconv.Resize(mask, size.X, size.Y)
+	}
+	return imgconv.EncodePNG(mask)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+const (
+	// pastedNewline stands in for line breaks inside a bracketed paste so
+	// that readline keeps the pasted text on one logical line.
+	pastedNewline = '\u2028'
+
+	tripleQuote    = `"""`
+	continuePrompt = "... "
+)
+
+var (
+	pasteStart = []byte("\x1b[200~")
+	pasteEnd   = []byte("\x1b[201~")
+)
+
+// pasteFilter strips bracketed paste markers from terminal input and turns
+// newlines inside a paste into pastedNewline.
+type pasteFilter struct {
+	r       io.Reader
+	pasting bool
+	pending []byte // raw bytes that may start a marker
+	ready   []byte // filtered bytes not yet returned
+}
+
+func newPasteFilter(r io.Reader) *pasteFilter {
+	return &pasteFilter{r: r}
+}
+
+// markerPrefix reports whether b could be the start of a paste marker. A
+// lone escape does not count, so the Esc key is never held back.
+func markerPrefix(b []byte) bool {
+	return len(b) > 1 && len(b) < len(pasteStart) &&
+		(bytes.HasPrefix(pasteStart, b) || bytes.HasPrefix(pasteEnd, b))
+}
+
+func (f *pasteFilter) Read(p []byte) (int, error) {
+	for len(f.ready) == 0 {
+		buf := make([]byte, len(p))
+		n, err := f.r.Read(buf)
+		f.filter(append(f.pending, buf[:n]...), err != nil)
+		if err != nil && len(f.ready) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, f.ready)
+	f.ready = f.ready[n:]
+	return n, nil
+}
+
+func (f *pasteFilter) filter(data []byte, final bool) {
+	f.pending = nil
+	for len(data) > 0 {
+		switch {
+		case bytes.HasPrefix(data, pasteStart):
+			f.pasting = true
+			data = data[len(pasteStart):]
+		case bytes.HasPrefix(data, pasteEnd):
+			f.pasting = false
+			data = data[len(pasteEnd):]
+		case !final && markerPrefix(data):
+			f.pending = append([]byte(nil), data...)
+			return
+		case f.pasting && (data[0] == '\r' || data[0] == '\n'):
+			if data[0] == '\r' && len(data) > 1 && data[1] == '\n' {
+				data = data[1:]
+			}
+			f.ready = append(f.ready, string(pastedNewline)...)
+			data = data[1:]
+		default:
+			f.ready = append(f.ready, data[0])
+			data = data[1:]
+		}
+	}
+}
+
+// inputReader reads chat messages from the REPL, supporting multi-line
+// composition, triple-quoted blocks, pasted text and $EDITOR.
+type inputReader struct {
+	rl     *readline.Instance
+	prompt string
+	multi  bool
+}
+
+// enableBracketedPaste asks the terminal to mark pasted text and returns a
+// function that turns it off again.
+func enableBracketedPaste() func() {
+	fmt.Print("\x1b[?2004h")
+	return func() { fmt.Print("\x1b[?2004l") }
+}
+
+// next returns the next message or command. Lines handled by the reader
+// itself, such as /multi, yield an empty string.
+func (in *inputReader) next() (string, error) {
+	line, err := in.rl.Readline()
+	if err != nil {
+		return "", err
+	}
+	line = strings.ReplaceAll(line, string(pastedNewline), "\n")
+
+	switch {
+	case line == "/multi":
+		in.multi = !in.multi
+		if in.multi {
+			fmt.Println("Multi-line mode on: an empty line or Ctrl-D sends the message")
+		} else {
+			fmt.Println("Multi-line mode off")
+		}
+		return "", nil
+	case line == "/edit" || strings.HasPrefix(line, "/edit "):
+		return editMessage(strings.TrimSpace(strings.TrimPrefix(line, "/edit")))
+	case strings.HasPrefix(strings.TrimSpace(line), tripleQuote):
+		return in.readBlock(strings.TrimPrefix(strings.TrimSpace(line), tripleQuote))
+	case in.multi && !strings.HasPrefix(line, "/"):
+		return in.readLines(line)
+	}
+	return line, nil
+}
+
+// readBlock collects lines until one ends with a closing triple quote.
+func (in *inputReader) readBlock(first string) (string, error) {
+	if strings.HasSuffix(first, tripleQuote) {
+		return strings.TrimSuffix(first, tripleQuote), nil
+	}
+	lines := []string{first}
+	if first == "" {
+		lines = nil
+	}
+	return in.collect(lines, func(line string) (string, bool) {
+		if strings.HasSuffix(line, tripleQuote) {
+			return strings.TrimSuffix(line, tripleQuote), true
+		}
+		return line, false
+	})
+}
+
+// readLines collects lines until an empty line.
+func (in *inputReader) readLines(first string) (string, error) {
+	if first == "" {
+		return "", nil
+	}
+	return in.collect([]string{first}, func(line string) (string, bool) {
+		return line, line == ""
+	})
+}
+
+// collect reads continuation lines, passing each to done, which reports
+// whether the message is complete. Ctrl-D also completes the message and
+// Ctrl-C abandons it.
+func (in *inputReader) collect(lines []string, done func(string) (string, bool)) (string, error) {
+	in.rl.SetPrompt(continuePrompt)
+	defer in.rl.SetPrompt(in.prompt)
+	for {
+		line, err := in.rl.Readline()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		line = strings.ReplaceAll(line, string(pastedNewline), "\n")
+		line, finished := done(line)
+		if line != "" || !finished {
+			lines = append(lines, line)
+		}
+		if finished {
+			break
+		}
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n"), nil
+}
+
+// editMessage opens $VISUAL or $EDITOR on a temporary file holding initial
+// and returns what the user saved.
+func editMessage(initial string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	f, err := os.CreateTemp("", "oai-message-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(initial); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	args := append(strings.Fields(editor), f.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	msg := strings.TrimSpace(string(b))
+	if msg == "" {
+		fmt.Println("Empty message, nothing sent")
+	}
+	return msg, nil
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path"
 	"strings"
+	"time"
 
+	"github.com/hmm01i/openai/pkg/retry"
 	"github.com/hmm01i/openai/pkg/version"
+	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
 
@@ -17,12 +22,48 @@ type appFiles struct {
 	conversationDir string
 	apiTokenFile    string
 	imageSaveDir    string
+	indexDir        string
+	moderationFile  string
+	auditLogFile    string
+	historyFile     string
 }
 
-var conf appFiles
+var (
+	conf      appFiles
+	apiPolicy = retry.DefaultPolicy()
+	verbose   bool
+	// lookupPolicy is for optional extras, such as the fine-tuned models
+	// added to /model list, which are not worth waiting or retrying for.
+	lookupPolicy = retry.Policy{MaxAttempts: 1, Timeout: 5 * time.Second}
+)
+
+// Exit codes used by non-interactive commands.
+const (
+	exitFailure = 1 // the request or an I/O operation failed
+	exitUsage   = 2 // the command was invoked incorrectly
+)
+
+// exitError carries a specific process exit code back to main.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
 
 func main() {
 	if err := Execute(); err != nil {
+		var ee *exitError
+		if errors.As(err, &ee) {
+			log.Printf("Error executing command: %v", ee.err)
+			os.Exit(ee.code)
+		}
 		log.Fatalf("Error executing command: %v", err)
 	}
 }
@@ -37,9 +78,14 @@ func (c *appFiles) initConfigs() error {
 	c.personasDir = path.Join(c.configDir, "personas")
 	c.conversationDir = path.Join(c.configDir, "conversations")
 	c.apiTokenFile = path.Join(c.configDir, "token")
+	c.auditLogFile = path.Join(c.configDir, "audit.log")
+	c.historyFile = path.Join(c.configDir, "history")
+	c.imageSaveDir = path.Join(c.configDir, "images")
+	c.indexDir = path.Join(c.configDir, "index")
+	c.moderationFile = path.Join(c.configDir, "moderation.json")
 
 	// Create directories with more restrictive permissions
-	for _, dir := range []string{c.configDir, c.personasDir, c.conversationDir} {
+	for _, dir := range []string{c.configDir, c.personasDir, c.conversationDir, c.imageSaveDir, c.indexDir} {
 		if err := os.MkdirAll(dir, 0700); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
@@ -68,6 +114,43 @@ func getAPIToken() string {
 	return token
 }
 
+// newOpenAIClient creates an API client. Setting OPENAI_BASE_URL points it at
+// another endpoint, such as the local stand-in started by "oai fakeapi".
+func newOpenAIClient(token string) *openai.Client {
+	return openai.NewClientWithConfig(newAPIConfig(token))
+}
+
+// newAPIConfig returns the client configuration, which also serves the
+// few calls made without the client library.
+func newAPIConfig(token string) openai.ClientConfig {
+	return newAPIConfigWith(token, &apiPolicy)
+}
+
+// newAPIConfigWith returns a client configuration that sends requests
+// according to policy.
+func newAPIConfigWith(token string, policy *retry.Policy) openai.ClientConfig {
+	config := openai.DefaultConfig(token)
+	config.HTTPClient = &authClient{HTTPDoer: retry.NewClient(policy), token: token}
+	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+		config.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+	return config
+}
+
+// authClient adds the API token to requests made without the client
+// library, which sets the same header on its own requests.
+type authClient struct {
+	openai.HTTPDoer
+	token string
+}
+
+func (a *authClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	return a.HTTPDoer.Do(req)
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "oai",
 	Short: "OpenAI CLI client",
@@ -77,6 +160,9 @@ Supports managing conversations, personas, and various AI interactions.`,
 		if err := conf.initConfigs(); err != nil {
 			return err
 		}
+		if verbose {
+			apiPolicy.Logf = log.Printf
+		}
 		return nil
 	},
 }
@@ -90,6 +176,11 @@ var versionCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log retried API calls and attempt counts")
+	rootCmd.PersistentFlags().IntVar(&apiPolicy.MaxAttempts, "max-attempts", apiPolicy.MaxAttempts, "Maximum attempts per API call, including the first")
+	rootCmd.PersistentFlags().DurationVar(&apiPolicy.Timeout, "timeout", apiPolicy.Timeout, "Timeout for each API call attempt (0 disables it)")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Render replies without colors (also set by NO_COLOR)")
+	rootCmd.PersistentFlags().BoolVar(&rawOutput, "raw", false, "Print replies as raw Markdown instead of rendering them")
 	rootCmd.AddCommand(versionCmd)
 }
 
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Moderation modes for a stage of the exchange.
+const (
+	moderationOff   = "off"
+	moderationWarn  = "warn"
+	moderationBlock = "block"
+)
+
+// Stages of an exchange that can be moderated.
+const (
+	stageInput  = "input"
+	stageOutput = "output"
+)
+
+// moderationPolicy says how each stage is checked. Empty fields are unset,
+// so a policy can override only part of another.
+type moderationPolicy struct {
+	Input  string `json:"input,omitempty"`
+	Output string `json:"output,omitempty"`
+	Model  string `json:"model,omitempty"`
+}
+
+// moderationConfig is the moderation.json file in the config directory: a
+// default policy and overrides for personas.
+//
+//	{"input": "block", "output": "warn", "personas": {"support": {"output": "block"}}}
+type moderationConfig struct {
+	moderationPolicy
+	Personas map[string]moderationPolicy `json:"personas,omitempty"`
+}
+
+// moderationFlag reports content flagged at a stage.
+type moderationFlag struct {
+	Stage      string   `json:"stage"`
+	Categories []string `json:"categories"`
+}
+
+func (f moderationFlag) String() string {
+	return fmt.Sprintf("%s flagged by moderation: %s", f.Stage, strings.Join(f.Categories, ", "))
+}
+
+// moderationError is returned when flagged content is blocked.
+type moderationError struct {
+	moderationFlag
+}
+
+func (e *moderationError) Error() string {
+	return fmt.Sprintf("%s blocked by moderation: %s", e.Stage, strings.Join(e.Categories, ", "))
+}
+
+// loadModerationConfig reads the moderation config. A missing file leaves
+// moderation off.
+func loadModerationConfig(file string) (moderationConfig, error) {
+	var cfg moderationConfig
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid %s: %w", file, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid %s: %w", file, err)
+	}
+	return cfg, nil
+}
+
+func (cfg moderationConfig) validate() error {
+	if err := cfg.moderationPolicy.validate(); err != nil {
+		return err
+	}
+	for name, p := range cfg.Personas {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("persona %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (p moderationPolicy) validate() error {
+	for _, mode := range []string{p.Input, p.Output} {
+		if mode == "" {
+			continue
+		}
+		if err := checkModerationMode(mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkModerationMode(mode string) error {
+	switch mode {
+	case moderationOff, moderationWarn, moderationBlock:
+		return nil
+	}
+	return fmt.Errorf("moderation mode must be off, warn or block, not %q", mode)
+}
+
+// with returns p with the fields set in o replacing its own.
+func (p moderationPolicy) with(o moderationPolicy) moderationPolicy {
+	if o.Input != "" {
+		p.Input = o.Input
+	}
+	if o.Output != "" {
+		p.Output = o.Output
+	}
+	if o.Model != "" {
+		p.Model = o.Model
+	}
+	return p
+}
+
+func (p moderationPolicy) mode(stage string) string {
+	mode := p.Input
+	if stage == stageOutput {
+		mode = p.Output
+	}
+	if mode == "" {
+		return moderationOff
+	}
+	return mode
+}
+
+// moderationPolicy returns the policy in force: the config default, then
+// the current persona's overrides, then those set with /moderation.
+func (c *chatClient) moderationPolicy() moderationPolicy {
+	if c.moderationLock != nil {
+		return *c.moderationLock
+	}
+	p := c.moderation.moderationPolicy
+	if o, ok := c.moderation.Personas[c.persona]; ok {
+		p = p.with(o)
+	}
+	return p.with(c.moderationOverride)
+}
+
+// moderate checks text for a stage of the exchange. Flagged content gives
+// a *moderationError when the stage blocks and is passed to onModeration
+// when it warns. A failed check only blocks in block mode.
+func (c *chatClient) moderate(ctx context.Context, stage, text string) error {
+	p := c.moderationPolicy()
+	mode := p.mode(stage)
+	if mode == moderationOff || strings.TrimSpace(text) == "" {
+		return nil
+	}
+	resp, err := c.client.Moderations(ctx, openai.ModerationRequest{Input: text, Model: p.Model})
+	if err != nil {
+		if mode == moderationBlock {
+			return fmt.Errorf("moderation check of %s failed: %w", stage, err)
+		}
+		log.Printf("moderation check of %s failed: %v", stage, err)
+		return nil
+	}
+	categories, flagged := flaggedCategories(resp.Results)
+	if !flagged {
+		return nil
+	}
+	flag := moderationFlag{Stage: stage, Categories: categories}
+	if mode == moderationBlock {
+		return &moderationError{flag}
+	}
+	if c.onModeration != nil {
+		c.onModeration(flag)
+	}
+	return nil
+}
+
+// flaggedCategories lists the categories flagged in results by their API
+// names, such as "harassment/threatening".
+func flaggedCategories(results []openai.Result) ([]string, bool) {
+	var categories []string
+	flagged := false
+	for _, r := range results {
+		if !r.Flagged {
+			continue
+		}
+		flagged = true
+		v := reflect.ValueOf(r.Categories)
+		for i := 0; i < v.NumField(); i++ {
+			name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+			if v.Field(i).Bool() && !containsString(categories, name) {
+				categories = append(categories, name)
+			}
+		}
+	}
+	if flagged && len(categories) == 0 {
+		// Newer models flag categories the client library does not name.
+		categories = []string{"unspecified"}
+	}
+	return categories, flagged
+}
+
+// lockModeration fixes the policy in force now for the rest of the session.
+func (c *chatClient) lockModeration() {
+	p := c.moderationPolicy()
+	c.moderationLock = &p
+}
+
+// SetModeration changes the mode of a stage for this session.
+func (c *chatClient) SetModeration(stage, mode string) error {
+	if c.moderationLock != nil {
+		return fmt.Errorf("moderation is fixed by %s here", conf.moderationFile)
+	}
+	if err := checkModerationMode(mode); err != nil {
+		return err
+	}
+	switch stage {
+	case stageInput:
+		c.moderationOverride.Input = mode
+	case stageOutput:
+		c.moderationOverride.Output = mode
+	default:
+		return fmt.Errorf("stage must be input or output, not %q", stage)
+	}
+	return nil
+}
+
+func (c *chatClient) ModerationStatus() string {
+	p := c.moderationPolicy()
+	model := p.Model
+	if model == "" {
+		model = "API default"
+	}
+	return fmt.Sprintf("Input: %s\nOutput: %s\nModel: %s", p.mode(stageInput), p.mode(stageOutput), model)
+}
+
+// printModeration warns about flagged content in the REPL.
+func printModeration(f moderationFlag) {
+	fmt.Printf("\033[33mWarning: %s\033[0m\n", f)
+}
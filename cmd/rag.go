@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hmm01i/openai/pkg/vecindex"
+)
+
+// defaultRAGTopK is how many chunks are retrieved for each question.
+const defaultRAGTopK = 4
+
+// ragSettings selects the index that questions are answered from.
+type ragSettings struct {
+	index string
+	topK  int
+}
+
+// source is a retrieved chunk as reported to the user.
+type source struct {
+	Citation string  `json:"citation"`
+	Score    float32 `json:"score"`
+}
+
+// EnableRAG makes every question retrieve context from the named index.
+func (c *chatClient) EnableRAG(index string, topK int) error {
+	if !vecindex.Exists(filepath.Join(conf.indexDir, index)) {
+		return fmt.Errorf("no index named %s; create it with oai index add", index)
+	}
+	if topK <= 0 {
+		topK = defaultRAGTopK
+	}
+	c.rag = &ragSettings{index: index, topK: topK}
+	return nil
+}
+
+func (c *chatClient) ListIndexes() []string {
+	return listIndexes()
+}
+
+func (c *chatClient) DisableRAG() {
+	c.rag = nil
+}
+
+// retrieve returns the context to send with input when retrieval is on,
+// and tells onRetrieve which sources it used.
+func (c *chatClient) retrieve(ctx context.Context, input string) (string, error) {
+	if c.rag == nil {
+		return "", nil
+	}
+	results, err := searchIndex(ctx, c.client, c.rag.index, input, c.rag.topK)
+	if err != nil {
+		return "", fmt.Errorf("retrieval from %s failed: %w", c.rag.index, err)
+	}
+
+	var sb strings.Builder
+	var sources []source
+	for _, r := range results {
+		if r.Score <= 0 {
+			continue
+		}
+		cite := chunkCitation(r.Chunk)
+		sources = append(sources, source{Citation: cite, Score: r.Score})
+		fmt.Fprintf(&sb, "[%d] %s\n%s\n\n", len(sources), cite, r.Text)
+	}
+	if c.onRetrieve != nil {
+		c.onRetrieve(sources)
+	}
+	if len(sources) == 0 {
+		return "", nil
+	}
+	return "Answer using these excerpts where they help, citing them by number like [1]. " +
+		"Say so if they do not cover the question.\n\n" + sb.String() + "Question: ", nil
+}
+
+// dropRetrieved removes retrieved context from the message at start once
+// the exchange is over, so saved conversations do not carry the excerpts.
+func (c *chatClient) dropRetrieved(start int, retrieved string) {
+	if retrieved != "" && len(c.history) > start {
+		c.history[start].Content = strings.Replace(c.history[start].Content, retrieved, "", 1)
+	}
+}
+
+// printSources shows the sources used for a reply in the REPL.
+func printSources(sources []source) {
+	fmt.Printf("\033[2m[rag] sources: %s\033[0m\n", formatSources(sources))
+}
+
+// formatSources lists sources with their citation numbers and scores.
+func formatSources(sources []source) string {
+	if len(sources) == 0 {
+		return "no relevant excerpts found"
+	}
+	var parts []string
+	for i, s := range sources {
+		parts = append(parts, fmt.Sprintf("[%d] %s (%.2f)", i+1, s.Citation, s.Score))
+	}
+	return strings.Join(parts, ", ")
+}
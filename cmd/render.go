@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/chzyer/readline"
+	"github.com/hmm01i/openai/pkg/markdown"
+)
+
+var (
+	noColor   bool
+	rawOutput bool
+)
+
+// replyWriter receives assistant replies as they stream in. Flush is called
+// once a reply is complete.
+type replyWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// rawWriter passes replies through unchanged.
+type rawWriter struct {
+	io.Writer
+}
+
+func (rawWriter) Flush() error {
+	return nil
+}
+
+// renderOptions returns how replies written to f should be rendered, or
+// false when they should be left raw: with --raw or when f is not a terminal.
+func renderOptions(f *os.File) (markdown.Options, bool) {
+	if rawOutput || !readline.IsTerminal(int(f.Fd())) {
+		return markdown.Options{}, false
+	}
+	opts := markdown.Options{Color: !noColor && os.Getenv("NO_COLOR") == ""}
+	if width := readline.GetScreenWidth(); width > 0 {
+		opts.Width = width
+	}
+	return opts, true
+}
+
+// newReplyWriter returns a writer that renders Markdown replies to f.
+func newReplyWriter(f *os.File) replyWriter {
+	opts, ok := renderOptions(f)
+	if !ok {
+		return rawWriter{f}
+	}
+	return markdown.NewWriter(f, opts)
+}
+
+// renderReply renders a complete reply for f.
+func renderReply(f *os.File, reply string) string {
+	opts, ok := renderOptions(f)
+	if !ok {
+		return reply
+	}
+	return markdown.Render(reply, opts)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// maxSpeechInput is the most characters the speech API accepts per request.
+// Longer text is split and saved as numbered parts.
+const maxSpeechInput = 4096
+
+var speechVoices = []string{"alloy", "ash", "ballad", "coral", "echo", "fable", "nova", "onyx", "sage", "shimmer", "verse"}
+
+var speechFormats = []string{"mp3", "opus", "aac", "flac", "wav", "pcm"}
+
+var (
+	speakOpts = speakOptions{
+		Model: string(openai.TTSModel1),
+		Voice: string(openai.VoiceAlloy),
+		Speed: 1,
+	}
+	speakFromFile string
+	speakOutput   string
+)
+
+// speakOptions are the parameters sent to the speech API.
+type speakOptions struct {
+	Model        string
+	Voice        string
+	Format       string
+	Speed        float64
+	Instructions string
+}
+
+var speakCmd = &cobra.Command{
+	Use:   "speak [text]",
+	Short: "Converts text to speech",
+	Long: `This command reads text aloud with the text-to-speech API and saves the audio.
+The text comes from the argument or, with --from-file, from a file ("-" for
+stdin). Text longer than 4096 characters is split at sentence boundaries and
+saved as numbered parts: -o talk.mp3 writes talk-1.mp3, talk-2.mp3, ...
+
+The format follows the output extension unless --format is given.`,
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		text, err := speakInput(args)
+		if err != nil {
+			return &exitError{exitUsage, err}
+		}
+		if err := speakOpts.validate(speakOutput); err != nil {
+			return &exitError{exitUsage, err}
+		}
+		if !cmd.Flags().Changed("output") {
+			speakOutput = "speech." + speakOpts.Format
+		}
+		files, err := synthesize(cmd.Context(), newOpenAIClient(getAPIToken()), text, speakOpts, speakOutput)
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		for _, f := range files {
+			fmt.Printf("The audio was saved as %s\n", f)
+		}
+		return nil
+	},
+}
+
+func init() {
+	speakCmd.Flags().StringVar(&speakFromFile, "from-file", "", "Read the text from a file, or - for stdin")
+	speakCmd.Flags().StringVarP(&speakOutput, "output", "o", "speech.mp3", "Audio file to write")
+	speakCmd.Flags().StringVar(&speakOpts.Voice, "voice", speakOpts.Voice, "Voice: "+strings.Join(speechVoices, ", "))
+	speakCmd.Flags().StringVarP(&speakOpts.Model, "model", "m", speakOpts.Model, "Speech model: tts-1, tts-1-hd or gpt-4o-mini-tts")
+	speakCmd.Flags().StringVarP(&speakOpts.Format, "format", "f", "", "Audio format: "+strings.Join(speechFormats, ", ")+" (default from the output extension)")
+	speakCmd.Flags().Float64Var(&speakOpts.Speed, "speed", speakOpts.Speed, "Speed from 0.25 to 4")
+	speakCmd.Flags().StringVar(&speakOpts.Instructions, "instructions", "", "How to speak, such as \"calm and slow\" (gpt-4o-mini-tts only)")
+	rootCmd.AddCommand(speakCmd)
+}
+
+// speakInput returns the text to speak from the argument or --from-file.
+func speakInput(args []string) (string, error) {
+	var text string
+	switch {
+	case len(args) == 1 && speakFromFile != "":
+		return "", errors.New("give the text as an argument or with --from-file, not both")
+	case len(args) == 1:
+		text = args[0]
+	case speakFromFile == "-":
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		text = string(b)
+	case speakFromFile != "":
+		b, err := os.ReadFile(speakFromFile)
+		if err != nil {
+			return "", err
+		}
+		text = string(b)
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", errors.New("no text to speak")
+	}
+	return text, nil
+}
+
+// validate checks the options and settles the format, taking it from the
+// extension of output when --format is not given.
+func (o *speakOptions) validate(output string) error {
+	if o.Format == "" {
+		o.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+		if o.Format == "" {
+			o.Format = string(openai.SpeechResponseFormatMp3)
+		}
+	}
+	if !containsString(speechFormats, o.Format) {
+		return fmt.Errorf("audio format must be one of %s", strings.Join(speechFormats, ", "))
+	}
+	if !containsString(speechVoices, o.Voice) {
+		return fmt.Errorf("voice must be one of %s", strings.Join(speechVoices, ", "))
+	}
+	if o.Speed < 0.25 || o.Speed > 4 {
+		return errors.New("speed must be between 0.25 and 4")
+	}
+	if o.Instructions != "" && o.Model != string(openai.TTSModelGPT4oMini) {
+		return fmt.Errorf("--instructions needs the %s model", openai.TTSModelGPT4oMini)
+	}
+	return nil
+}
+
+// synthesize speaks text and saves the audio under output, returning the
+// files written.
+func synthesize(ctx context.Context, client *openai.Client, text string, opts speakOptions, output string) ([]string, error) {
+	chunks := speechChunks(text, maxSpeechInput)
+	files := numberedFileNames(output, len(chunks))
+	for i, chunk := range chunks {
+		resp, err := client.CreateSpeech(ctx, openai.CreateSpeechRequest{
+			Model:          openai.SpeechModel(opts.Model),
+			Input:          chunk,
+			Voice:          openai.SpeechVoice(opts.Voice),
+			Instructions:   opts.Instructions,
+			ResponseFormat: openai.SpeechResponseFormat(opts.Format),
+			Speed:          opts.Speed,
+		})
+		if err != nil {
+			return files[:i], fmt.Errorf("speech synthesis failed: %w", err)
+		}
+		err = saveSpeech(resp, files[i])
+		if err != nil {
+			return files[:i], err
+		}
+	}
+	return files, nil
+}
+
+func saveSpeech(resp openai.RawResponse, file string) error {
+	defer resp.Close()
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("file creation error: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp); err != nil {
+		return fmt.Errorf("audio download failed: %w", err)
+	}
+	return f.Close()
+}
+
+// speechChunks splits text into pieces of at most max bytes, breaking after
+// paragraphs or sentences where it can and between words otherwise.
+func speechChunks(text string, max int) []string {
+	var chunks []string
+	text = strings.TrimSpace(text)
+	for len(text) > max {
+		cut := -1
+		for _, sep := range []string{"\n\n", ". ", "! ", "? ", "\n", " "} {
+			if i := strings.LastIndex(text[:max], sep); i > 0 {
+				cut = i + len(sep)
+				break
+			}
+		}
+		if cut < 0 {
+			// No break at all; back up to a rune boundary.
+			cut = max
+			for cut > 0 && !isRuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	return append(chunks, text)
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xc0 != 0x80
+}
+
+// speakableText drops fenced code blocks from a reply, which read badly
+// aloud.
+func speakableText(reply string) string {
+	var lines []string
+	fence := ""
+	for _, line := range strings.Split(reply, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			lines = append(lines, "(code omitted)")
+		default:
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSuffix(strings.Join(lines, "\n"), interruptedMarker)
+}
+
+// SetSpeech turns /tts on or off. Replies are saved in a directory named
+// after the conversation inside the conversations directory.
+func (c *chatClient) SetSpeech(on bool) string {
+	if !on {
+		c.speech = nil
+		return "Speech off"
+	}
+	if c.conversation == "" {
+		c.conversation = "session-" + time.Now().Format("20060102-150405")
+	}
+	c.speech = &speakOptions{
+		Model:  string(openai.TTSModel1),
+		Voice:  string(openai.VoiceAlloy),
+		Format: string(openai.SpeechResponseFormatMp3),
+		Speed:  1,
+	}
+	return fmt.Sprintf("Speech on: replies are saved in %s", c.speechDir())
+}
+
+func (c *chatClient) speechDir() string {
+	return filepath.Join(conf.conversationDir, c.conversation+".audio")
+}
+
+// speakReply saves reply as audio when /tts is on, returning the files
+// written.
+func (c *chatClient) speakReply(ctx context.Context, reply string) ([]string, error) {
+	if c.speech == nil {
+		return nil, nil
+	}
+	text := speakableText(reply)
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	dir := c.speechDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("reply-%d.%s", len(c.replies()), c.speech.Format))
+	return synthesize(ctx, c.client, text, *c.speech, file)
+}
+
+// announceSpeech saves reply as audio when /tts is on and tells w where.
+func (c *chatClient) announceSpeech(ctx context.Context, reply string, w io.Writer) error {
+	files, err := c.speakReply(ctx, reply)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Fprintf(w, "\033[90mAudio: %s\033[0m\n", f)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/hmm01i/openai/pkg/tools"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxToolRounds bounds how many times in a row the model may call tools
+// before giving an answer.
+const maxToolRounds = 10
+
+var (
+	fsRoot string
+	fsYes  bool
+
+	shellEnabled   bool
+	shellTimeout   time.Duration
+	shellCPU       int
+	shellMaxOutput int
+)
+
+// runToolCalls executes the tools requested by the model and appends their
+// results to the history. Failures are reported back to the model as the
+// tool result so it can recover.
+func (c *chatClient) runToolCalls(ctx context.Context, calls []openai.ToolCall) {
+	for _, call := range calls {
+		result, err := c.tools.Call(ctx, call.Function.Name, call.Function.Arguments)
+		if c.onToolCall != nil {
+			c.onToolCall(call, result, err)
+		}
+		if err != nil {
+			result = fmt.Sprintf("error: %s", err.Error())
+		}
+		c.history = append(c.history, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    result,
+			ToolCallID: call.ID,
+		})
+	}
+}
+
+// mergeToolCallDeltas folds the tool call fragments of one streamed chunk
+// into the calls assembled so far.
+func mergeToolCallDeltas(calls, deltas []openai.ToolCall) []openai.ToolCall {
+	for _, d := range deltas {
+		i := len(calls)
+		if d.Index != nil {
+			i = *d.Index
+		}
+		for len(calls) <= i {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		if d.ID != "" {
+			calls[i].ID = d.ID
+		}
+		if d.Type != "" {
+			calls[i].Type = d.Type
+		}
+		calls[i].Function.Name += d.Function.Name
+		calls[i].Function.Arguments += d.Function.Arguments
+	}
+	return calls
+}
+
+// printToolCall shows a tool call in the REPL.
+func printToolCall(call openai.ToolCall, result string, err error) {
+	fmt.Printf("\033[2m[tool] %s(%s)", call.Function.Name, call.Function.Arguments)
+	if err != nil {
+		fmt.Printf(" failed: %s\033[0m\n", err)
+		return
+	}
+	fmt.Printf(" -> %d bytes\033[0m\n", len(result))
+}
+
+func (c *chatClient) ListTools() []string {
+	return c.tools.Names()
+}
+
+// hostPath checks a file named in a slash command. When paths are confined,
+// relative names are taken from the root and anything that resolves outside
+// it is refused.
+func (c *chatClient) hostPath(name string) (string, error) {
+	if !c.confinePaths {
+		return name, nil
+	}
+	if c.pathRoot == nil {
+		return "", fmt.Errorf("files cannot be used here without --fs-root")
+	}
+	return c.pathRoot.Resolve(name)
+}
+
+// hostPattern is hostPath for a glob pattern. When paths are confined, the
+// pattern must stay under the root, so that matches elsewhere are not even
+// listed; each file it matches still has to pass hostPath.
+func (c *chatClient) hostPattern(pattern string) (string, error) {
+	if !c.confinePaths {
+		return pattern, nil
+	}
+	if c.pathRoot == nil {
+		return "", fmt.Errorf("files cannot be used here without --fs-root")
+	}
+	clean := filepath.Clean(pattern)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the allowed directory %s", pattern, c.pathRoot.Root())
+	}
+	return filepath.Join(c.pathRoot.Root(), clean), nil
+}
+
+// enableFilesystemTools registers the file tools when --fs-root is set.
+// Writes go through approve unless --yes marks the directory as trusted.
+func enableFilesystemTools(c *chatClient, approve tools.Approver) error {
+	if fsRoot == "" {
+		return nil
+	}
+	sandbox, err := tools.NewSandbox(fsRoot)
+	if err != nil {
+		return fmt.Errorf("invalid --fs-root: %w", err)
+	}
+	if fsYes {
+		approve = tools.AlwaysApprove
+	}
+	return tools.RegisterFilesystem(c.tools, sandbox, approve)
+}
+
+// enableShellTool registers the run_command tool when --shell is set. It
+// runs in --fs-root if given, else the current directory, and every command
+// needs approval regardless of --yes.
+func enableShellTool(c *chatClient, approve tools.Approver) error {
+	if !shellEnabled {
+		return nil
+	}
+	config, err := shellConfig()
+	if err != nil {
+		return err
+	}
+	return tools.RegisterShell(c.tools, config, approve)
+}
+
+// shellConfig returns the limits set with the --shell flags, for commands
+// run in --fs-root if given, else the current directory.
+func shellConfig() (tools.ShellConfig, error) {
+	dir := fsRoot
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return tools.ShellConfig{}, err
+		}
+		dir = wd
+	}
+	return tools.ShellConfig{
+		Dir:        dir,
+		Timeout:    shellTimeout,
+		CPUSeconds: shellCPU,
+		MaxOutput:  shellMaxOutput,
+		AuditLog:   conf.auditLogFile,
+	}, nil
+}
+
+// confirmWith returns an approver that asks a y/n question on the REPL.
+// Any lines before the last line of prompt are printed above the question.
+func confirmWith(rl *readline.Instance) tools.Approver {
+	return func(prompt string) bool {
+		if i := strings.LastIndexByte(prompt, '\n'); i >= 0 {
+			fmt.Println(prompt[:i])
+			prompt = prompt[i+1:]
+		}
+		rl.SetPrompt(prompt + " [y/N] ")
+		defer rl.SetPrompt("> ")
+		line, err := rl.Readline()
+		if err != nil {
+			return false
+		}
+		answer := strings.ToLower(strings.TrimSpace(line))
+		return answer == "y" || answer == "yes"
+	}
+}
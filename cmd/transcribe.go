@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// maxAudioUpload is the largest file the audio API accepts.
+const maxAudioUpload = 25 << 20
+
+// audioExtensions are the file types the audio API accepts.
+var audioExtensions = []string{".flac", ".m4a", ".mp3", ".mp4", ".mpeg", ".mpga", ".oga", ".ogg", ".wav", ".webm"}
+
+var (
+	transcribeOpts = transcribeOptions{
+		Model:  openai.Whisper1,
+		Format: string(openai.AudioResponseFormatText),
+	}
+	transcribeOutput string
+)
+
+// transcribeOptions are the parameters sent to the audio API.
+type transcribeOptions struct {
+	Model     string
+	Language  string
+	Prompt    string
+	Format    string
+	Translate bool
+}
+
+var transcribeCmd = &cobra.Command{
+	Use:   "transcribe <file>",
+	Short: "Transcribes an audio file",
+	Long: `This command turns speech in an audio file into text with Whisper. With
+--translate the speech is translated into English instead.
+
+Files may be flac, m4a, mp3, mp4, mpeg, mpga, ogg, wav or webm and must be
+under 25 MB. The transcript is printed unless --output is given.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := transcribeOpts.validate(); err != nil {
+			return &exitError{exitUsage, err}
+		}
+		text, err := transcribe(cmd.Context(), newOpenAIClient(getAPIToken()), args[0], transcribeOpts)
+		if err != nil {
+			return &exitError{exitFailure, err}
+		}
+		if transcribeOutput == "" {
+			fmt.Print(text)
+			return nil
+		}
+		if err := os.WriteFile(transcribeOutput, []byte(text), 0644); err != nil {
+			return &exitError{exitFailure, err}
+		}
+		fmt.Printf("The transcript was saved as %s\n", transcribeOutput)
+		return nil
+	},
+}
+
+func init() {
+	transcribeCmd.Flags().StringVarP(&transcribeOpts.Language, "language", "l", "", "Language of the audio as an ISO-639-1 code, such as en or de")
+	transcribeCmd.Flags().StringVarP(&transcribeOpts.Prompt, "prompt", "p", "", "Text to guide the style or spelling of the transcript")
+	transcribeCmd.Flags().StringVarP(&transcribeOpts.Format, "format", "f", transcribeOpts.Format, "Output format: text, json, verbose_json, srt or vtt")
+	transcribeCmd.Flags().StringVarP(&transcribeOpts.Model, "model", "m", transcribeOpts.Model, "Transcription model")
+	transcribeCmd.Flags().BoolVarP(&transcribeOpts.Translate, "translate", "t", false, "Translate the speech into English")
+	transcribeCmd.Flags().StringVarP(&transcribeOutput, "output", "o", "", "File to write the transcript to")
+	rootCmd.AddCommand(transcribeCmd)
+}
+
+func (o transcribeOptions) validate() error {
+	switch openai.AudioResponseFormat(o.Format) {
+	case openai.AudioResponseFormatText, openai.AudioResponseFormatJSON, openai.AudioResponseFormatVerboseJSON,
+		openai.AudioResponseFormatSRT, openai.AudioResponseFormatVTT:
+	default:
+		return fmt.Errorf("format must be text, json, verbose_json, srt or vtt")
+	}
+	if o.Translate && o.Language != "" {
+		return fmt.Errorf("--language cannot be used with --translate, which always produces English")
+	}
+	return nil
+}
+
+// checkAudioFile reports files the audio API would reject, before they are
+// uploaded.
+func checkAudioFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if !containsString(audioExtensions, strings.ToLower(filepath.Ext(path))) {
+		return fmt.Errorf("%s: unsupported audio type; use one of %s", path, strings.Join(audioExtensions, ", "))
+	}
+	if info.Size() > maxAudioUpload {
+		return fmt.Errorf("%s is %d MB; the limit is 25 MB", path, info.Size()>>20)
+	}
+	return nil
+}
+
+// transcribe sends an audio file to the transcription or translation
+// endpoint and returns the result in the requested format.
+func transcribe(ctx context.Context, client *openai.Client, path string, opts transcribeOptions) (string, error) {
+	if err := checkAudioFile(path); err != nil {
+		return "", err
+	}
+	req := openai.AudioRequest{
+		Model:    opts.Model,
+		FilePath: path,
+		Prompt:   opts.Prompt,
+		Language: opts.Language,
+		Format:   openai.AudioResponseFormat(opts.Format),
+	}
+
+	var resp openai.AudioResponse
+	var err error
+	if opts.Translate {
+		resp, err = client.CreateTranslation(ctx, req)
+	} else {
+		resp, err = client.CreateTranscription(ctx, req)
+	}
+	if err != nil {
+		return "", fmt.Errorf("transcription failed: %w", err)
+	}
+
+	switch req.Format {
+	case openai.AudioResponseFormatJSON:
+		return marshalTranscript(struct {
+			Text string `json:"text"`
+		}{resp.Text})
+	case openai.AudioResponseFormatVerboseJSON:
+		return marshalTranscript(resp)
+	}
+	if !strings.HasSuffix(resp.Text, "\n") {
+		resp.Text += "\n"
+	}
+	return resp.Text, nil
+}
+
+func marshalTranscript(v interface{}) (string, error) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+// Transcribe adds the transcript of an audio file to the conversation as a
+// user message, so the next question can refer to it.
+func (c *chatClient) Transcribe(ctx context.Context, path string) (string, error) {
+	file, err := c.hostPath(path)
+	if err != nil {
+		return "", err
+	}
+	opts := transcribeOptions{Model: openai.Whisper1, Format: string(openai.AudioResponseFormatText)}
+	text, err := transcribe(ctx, c.client, file, opts)
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(text)
+	content := fmt.Sprintf("Transcript of %s:\n\n%s", filepath.Base(path), text)
+	if err := c.moderate(ctx, stageInput, content); err != nil {
+		return "", err
+	}
+	c.history = append(c.history, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: content,
+	})
+	return fmt.Sprintf("Added the transcript of %s (%d words) to the conversation", path, len(strings.Fields(text))), nil
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/hmm01i/openai/pkg/commands"
+	"github.com/hmm01i/openai/pkg/markdown"
+	"github.com/rivo/tview"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// modelPrices are USD prices per million prompt and completion tokens, used
+// for the cost estimate in the status bar. Longer prefixes win.
+var modelPrices = map[string][2]float64{
+	"gpt-4":         {30, 60},
+	"gpt-4-32k":     {60, 120},
+	"gpt-4-turbo":   {10, 30},
+	"gpt-4o":        {2.5, 10},
+	"gpt-4o-mini":   {0.15, 0.6},
+	"gpt-4.1":       {2, 8},
+	"gpt-4.1-mini":  {0.4, 1.6},
+	"gpt-4.1-nano":  {0.1, 0.4},
+	"gpt-3.5-turbo": {0.5, 1.5},
+	"o1":            {15, 60},
+	"o1-mini":       {1.1, 4.4},
+	"o3-mini":       {1.1, 4.4},
+}
+
+// usageCost estimates the cost of u on model. It reports false when the
+// model's price is unknown.
+func usageCost(model string, u openai.Usage) (float64, bool) {
+	var price [2]float64
+	best := -1
+	for prefix, p := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > best {
+			price, best = p, len(prefix)
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	return (float64(u.PromptTokens)*price[0] + float64(u.CompletionTokens)*price[1]) / 1e6, true
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Start a full-screen chat session",
+	Long: `This command starts a full-screen chat with a scrollable conversation, a
+multi-line input box and a sidebar of personas and saved conversations.
+Slash commands work as in "oai chat".
+
+Keys: Enter sends, Alt-Enter inserts a newline, Tab moves between panes,
+Ctrl-C cancels a running request or quits.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newTUI(chatC).run()
+	},
+}
+
+func init() {
+	tuiCmd.Flags().StringVar(&fsRoot, "fs-root", "", "Let the model read and write files under this directory")
+	tuiCmd.Flags().BoolVarP(&fsYes, "yes", "y", false, "Allow file writes under --fs-root without asking")
+	rootCmd.AddCommand(tuiCmd)
+}
+
+// tui is a full-screen chat session. Widgets are only touched from the
+// tview event loop; requests run in their own goroutine and report back
+// through QueueUpdateDraw.
+type tui struct {
+	c             *chatClient
+	app           *tview.Application
+	pages         *tview.Pages
+	messages      *tview.TextView
+	input         *tview.TextArea
+	personas      *tview.List
+	conversations *tview.List
+	status        *tview.TextView
+
+	busy     bool
+	cancel   context.CancelFunc
+	ctx      context.Context // of the running request, for confirm
+	cost     float64
+	costSure bool // false once usage was spent on a model without a price
+}
+
+func newTUI(c *chatClient) *tui {
+	t := &tui{
+		c:             c,
+		app:           tview.NewApplication(),
+		pages:         tview.NewPages(),
+		messages:      tview.NewTextView(),
+		input:         tview.NewTextArea(),
+		personas:      tview.NewList(),
+		conversations: tview.NewList(),
+		status:        tview.NewTextView(),
+		costSure:      true,
+	}
+
+	t.messages.SetDynamicColors(true).SetScrollable(true).SetWordWrap(true).
+		SetChangedFunc(func() { t.app.Draw() })
+	t.messages.SetBorder(true).SetTitle(" Conversation ")
+
+	t.input.SetPlaceholder("Message or /command (Enter sends, Alt-Enter adds a line)")
+	t.input.SetBorder(true)
+	t.input.SetInputCapture(t.inputKey)
+
+	t.personas.ShowSecondaryText(false).SetBorder(true).SetTitle(" Personas ")
+	t.personas.SetSelectedFunc(func(_ int, name, _ string, _ rune) {
+		t.command("/persona load " + strings.TrimSuffix(name, "*"))
+	})
+	t.conversations.ShowSecondaryText(false).SetBorder(true).SetTitle(" Conversations ")
+	t.conversations.SetSelectedFunc(func(_ int, name, _ string, _ rune) {
+		t.command("/conversation load " + name)
+	})
+
+	t.status.SetDynamicColors(true)
+
+	sidebar := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.personas, 0, 1, false).
+		AddItem(t.conversations, 0, 1, false)
+	main := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.messages, 0, 1, false).
+		AddItem(t.input, 5, 0, true)
+	body := tview.NewFlex().
+		AddItem(sidebar, 28, 0, false).
+		AddItem(main, 0, 1, true)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(body, 0, 1, true).
+		AddItem(t.status, 1, 0, false)
+	t.pages.AddPage("main", root, true, true)
+
+	t.app.SetRoot(t.pages, true).SetFocus(t.input).EnableMouse(true)
+	t.app.SetInputCapture(t.appKey)
+	return t
+}
+
+func (t *tui) run() error {
+	t.c.confirm = t.confirm
+	t.c.copyText = t.copyText
+	t.c.onToolCall = func(call openai.ToolCall, result string, err error) {
+		line := fmt.Sprintf("[tool] %s(%s) -> %d bytes", call.Function.Name, call.Function.Arguments, len(result))
+		if err != nil {
+			line = fmt.Sprintf("[tool] %s(%s) failed: %s", call.Function.Name, call.Function.Arguments, err)
+		}
+		fmt.Fprintf(t.messages, "[gray]%s[-]\n", tview.Escape(line))
+	}
+	if err := enableFilesystemTools(t.c, t.confirm); err != nil {
+		return err
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	t.app.SetScreen(&pasteScreen{Screen: screen})
+
+	t.refreshSidebar()
+	t.showHistory()
+	t.updateStatus()
+	return t.app.Run()
+}
+
+// pasteScreen turns Enter keys inside a bracketed paste into Alt-Enter, so
+// pasted text lands in the input box as separate lines instead of sending
+// each line as a message.
+type pasteScreen struct {
+	tcell.Screen
+	pasting bool // only used by the event polling goroutine
+}
+
+func (s *pasteScreen) Init() error {
+	if err := s.Screen.Init(); err != nil {
+		return err
+	}
+	s.Screen.EnablePaste()
+	return nil
+}
+
+func (s *pasteScreen) PollEvent() tcell.Event {
+	for {
+		switch ev := s.Screen.PollEvent().(type) {
+		case *tcell.EventPaste:
+			s.pasting = ev.Start()
+		case *tcell.EventKey:
+			if s.pasting && ev.Key() == tcell.KeyEnter {
+				return tcell.NewEventKey(tcell.KeyEnter, '\n', tcell.ModAlt)
+			}
+			return ev
+		default:
+			return ev
+		}
+	}
+}
+
+// appKey handles keys that work in every pane.
+func (t *tui) appKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyCtrlC:
+		if t.busy {
+			if t.cancel != nil {
+				t.cancel()
+			}
+			return nil
+		}
+		t.app.Stop()
+		return nil
+	case tcell.KeyTab:
+		if t.pages.HasPage("confirm") {
+			return event
+		}
+		order := []tview.Primitive{t.input, t.messages, t.personas, t.conversations}
+		for i, p := range order {
+			if p.HasFocus() {
+				t.app.SetFocus(order[(i+1)%len(order)])
+				return nil
+			}
+		}
+		t.app.SetFocus(t.input)
+		return nil
+	case tcell.KeyEscape:
+		if !t.pages.HasPage("confirm") {
+			t.app.SetFocus(t.input)
+			return nil
+		}
+	}
+	return event
+}
+
+// inputKey sends the input on Enter and turns Alt-Enter into a newline.
+func (t *tui) inputKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() != tcell.KeyEnter {
+		return event
+	}
+	if event.Modifiers()&tcell.ModAlt != 0 {
+		return tcell.NewEventKey(tcell.KeyEnter, '\n', tcell.ModNone)
+	}
+	text := strings.TrimSpace(t.input.GetText())
+	if text == "" || t.busy {
+		return nil
+	}
+	t.input.SetText("", false)
+	if strings.HasPrefix(text, "/") {
+		t.command(text)
+	} else {
+		t.send(text)
+	}
+	return nil
+}
+
+// command runs a slash command through the command registry, as the REPL
+// does, and shows its result.
+func (t *tui) command(line string) {
+	if t.busy {
+		return
+	}
+	if line == "/q" {
+		t.app.Stop()
+		return
+	}
+	fmt.Fprintf(t.messages, "[yellow]%s[-]\n", tview.Escape(line))
+	before := len(t.c.history)
+	t.start(func(ctx context.Context) func() {
+		resp := t.c.cmdRegistry.ExecuteCommand(ctx, t.c, line)
+		return func() {
+			var cmdResp commands.CommandResponse
+			switch err := json.Unmarshal([]byte(resp), &cmdResp); {
+			case resp == "":
+			case err != nil:
+				fmt.Fprintf(t.messages, "[red]Error: %s[-]\n", tview.Escape(err.Error()))
+			case !cmdResp.Success:
+				fmt.Fprintf(t.messages, "[red]Error: %s[-]\n", tview.Escape(cmdResp.Error))
+			default:
+				fmt.Fprintf(t.messages, "%s\n", tview.Escape(cmdResp.Message))
+			}
+			fmt.Fprint(t.messages, "\n")
+			if len(t.c.history) != before {
+				t.showHistory()
+			}
+			t.refreshSidebar()
+		}
+	})
+}
+
+// send sends a chat message and streams the rendered reply into the
+// conversation pane.
+func (t *tui) send(text string) {
+	t.writeMessage(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: text})
+	fmt.Fprint(t.messages, "[::b]Assistant[::-]\n")
+	out := t.replyWriter()
+	t.c.onRetrieve = func(sources []source) {
+		fmt.Fprintf(t.messages, "[gray]Sources: %s[-]\n", tview.Escape(formatSources(sources)))
+	}
+	t.c.onModeration = func(f moderationFlag) {
+		fmt.Fprintf(t.messages, "[yellow]Warning: %s[-]\n", tview.Escape(f.String()))
+	}
+	t.start(func(ctx context.Context) func() {
+		model, before := t.c.model, t.c.usage
+		reply, err := t.c.chatStream(ctx, text, out)
+		out.Flush()
+		fmt.Fprint(t.messages, "\n")
+		var audio []string
+		if err == nil {
+			audio, err = t.c.speakReply(ctx, reply)
+		}
+		spent := openai.Usage{
+			PromptTokens:     t.c.usage.PromptTokens - before.PromptTokens,
+			CompletionTokens: t.c.usage.CompletionTokens - before.CompletionTokens,
+		}
+		return func() {
+			switch {
+			case errors.Is(err, context.Canceled):
+				fmt.Fprint(t.messages, "[yellow]Request cancelled[-]\n")
+			case err != nil:
+				fmt.Fprintf(t.messages, "[red]Error: %s[-]\n", tview.Escape(err.Error()))
+			}
+			for _, f := range audio {
+				fmt.Fprintf(t.messages, "[gray]Audio: %s[-]\n", tview.Escape(f))
+			}
+			fmt.Fprint(t.messages, "\n")
+			cost, ok := usageCost(model, spent)
+			t.cost += cost
+			t.costSure = t.costSure && (ok || spent.PromptTokens+spent.CompletionTokens == 0)
+		}
+	})
+}
+
+// start runs work in the background with a cancellable context. The
+// function work returns is run on the event loop once it finishes.
+func (t *tui) start(work func(ctx context.Context) func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.busy, t.cancel, t.ctx = true, cancel, ctx
+	t.updateStatus()
+	go func() {
+		done := work(ctx)
+		cancel()
+		t.app.QueueUpdateDraw(func() {
+			t.busy, t.cancel = false, nil
+			done()
+			t.messages.ScrollToEnd()
+			t.updateStatus()
+		})
+	}()
+}
+
+// confirm asks a yes/no question in a modal dialog. It is called from
+// request goroutines and blocks until the user answers or the request is
+// cancelled, which counts as no.
+func (t *tui) confirm(prompt string) bool {
+	ctx := t.ctx
+	answer := make(chan bool, 1)
+	t.app.QueueUpdateDraw(func() {
+		modal := tview.NewModal().
+			SetText(prompt).
+			AddButtons([]string{"No", "Yes"}).
+			SetDoneFunc(func(_ int, label string) {
+				t.pages.RemovePage("confirm")
+				t.app.SetFocus(t.input)
+				answer <- label == "Yes"
+			})
+		t.pages.AddPage("confirm", modal, true, true)
+		t.app.SetFocus(modal)
+	})
+	select {
+	case ok := <-answer:
+		return ok
+	case <-ctx.Done():
+		t.app.QueueUpdateDraw(func() {
+			if t.pages.HasPage("confirm") {
+				t.pages.RemovePage("confirm")
+				t.app.SetFocus(t.input)
+			}
+		})
+		return false
+	}
+}
+
+// copyText writes the clipboard escape sequence while the screen is
+// suspended, so that it does not land in the middle of tview's output.
+func (t *tui) copyText(text string) error {
+	var err error
+	if !t.app.Suspend(func() { _, err = fmt.Fprint(os.Stdout, osc52(text)) }) {
+		return errors.New("the screen could not be suspended")
+	}
+	return err
+}
+
+// replyWriter renders Markdown into the conversation pane at its current
+// width.
+func (t *tui) replyWriter() replyWriter {
+	_, _, width, _ := t.messages.GetInnerRect()
+	return markdown.NewWriter(&escapeWriter{w: tview.ANSIWriter(t.messages)}, markdown.Options{
+		Width: width,
+		Color: !noColor && os.Getenv("NO_COLOR") == "",
+	})
+}
+
+// showHistory redraws the conversation pane from the chat history.
+func (t *tui) showHistory() {
+	t.messages.Clear()
+	for _, m := range t.c.history {
+		t.writeMessage(m)
+	}
+	t.messages.ScrollToEnd()
+}
+
+func (t *tui) writeMessage(m openai.ChatCompletionMessage) {
+	switch {
+	case m.Role == openai.ChatMessageRoleUser:
+		fmt.Fprintf(t.messages, "[::b]You[::-]\n%s\n\n", tview.Escape(m.Content))
+	case m.Role == openai.ChatMessageRoleAssistant && m.Content != "":
+		fmt.Fprint(t.messages, "[::b]Assistant[::-]\n")
+		out := t.replyWriter()
+		io.WriteString(out, m.Content)
+		out.Flush()
+		fmt.Fprint(t.messages, "\n\n")
+	}
+}
+
+func (t *tui) refreshSidebar() {
+	t.personas.Clear()
+	for _, p := range t.c.listPersonas() {
+		if p == t.c.persona {
+			p += "*"
+		}
+		t.personas.AddItem(p, "", 0, nil)
+	}
+	t.conversations.Clear()
+	for _, name := range t.c.listConversations() {
+		t.conversations.AddItem(name, "", 0, nil)
+	}
+}
+
+func (t *tui) updateStatus() {
+	u := t.c.usage
+	cost := fmt.Sprintf("$%.4f", t.cost)
+	if !t.costSure {
+		cost += "+?"
+	}
+	state := "Ready"
+	if t.busy {
+		state = "[yellow]Working... (Ctrl-C cancels)[-]"
+	}
+	t.status.SetText(fmt.Sprintf(" %s │ Model: %s │ Persona: %s │ Tokens: %d (%d in, %d out) │ Cost: %s",
+		state, tview.Escape(t.c.model), tview.Escape(t.c.persona),
+		u.TotalTokens, u.PromptTokens, u.CompletionTokens, cost))
+}
+
+// escapeWriter escapes tview color tags in text written to it, leaving ANSI
+// escape sequences intact for tview.ANSIWriter to translate.
+type escapeWriter struct {
+	w io.Writer
+}
+
+func (e *escapeWriter) Write(p []byte) (int, error) {
+	var b strings.Builder
+	s := string(p)
+	for len(s) > 0 {
+		i := strings.Index(s, "\x1b[")
+		if i < 0 {
+			b.WriteString(tview.Escape(s))
+			break
+		}
+		b.WriteString(tview.Escape(s[:i]))
+		end := i + 2
+		for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+			end++
+		}
+		if end < len(s) {
+			end++
+		}
+		b.WriteString(s[i:end])
+		s = s[end:]
+	}
+	if _, err := io.WriteString(e.w, b.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -4,9 +4,10 @@ go 1.20
 
 require (
 	github.com/chzyer/readline v1.5.1
+	github.com/gdamore/tcell/v2 v2.6.0
 	github.com/gin-gonic/gin v1.9.0
 	github.com/rivo/tview v0.0.0-20230504092913-51ba3688bcdd
-	github.com/sashabaranov/go-openai v1.5.7
+	github.com/sashabaranov/go-openai v1.41.2
 	github.com/spf13/cobra v1.6.1
 )
 
@@ -14,7 +15,6 @@ require (
 	github.com/bytedance/sonic v1.8.0 // indirect
 	github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
 	github.com/gdamore/encoding v1.0.0 // indirect
-	github.com/gdamore/tcell/v2 v2.6.0 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
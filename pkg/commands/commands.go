@@ -1,8 +1,10 @@
 package commands
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -15,10 +17,15 @@ type CommandResponse struct {
 
 // Command represents a command or subcommand
 type Command struct {
-	Execute   func(c ChatClient, args []string) string
+	Execute   func(ctx context.Context, c ChatClient, args []string) string
 	Help      string
 	SubCmds   map[string]*Command
 	MinAccess AccessLevel // Minimum access level required for this command
+	// Complete returns candidates for the command's first argument
+	Complete func(ctx context.Context, c ChatClient) []string
+	// CompleteRemote marks candidates fetched from the API, which are
+	// reused for a while rather than fetched on every Tab
+	CompleteRemote bool
 }
 
 // AccessLevel represents the feature flag level for commands
@@ -41,13 +48,30 @@ type ChatClient interface {
 	LoadPersona(name string) error
 	SetDirective(directive string) error
 	ClearHistory()
-	ListModels() []string
+	ListModels(ctx context.Context) ([]string, error)
 	SetModel(model string)
 	SaveConversation(name string) error
 	ListConversations() []string
 	LoadConversation(name string) error
 	GetCurrentPersona() string
 	GetHistory() []Message
+	ListTools() []string
+	AttachFiles(patterns []string) ([]string, error)
+	ListAttachments() []string
+	ClearAttachments()
+	ListCodeBlocks(reply int) ([]string, error)
+	SaveCodeBlock(n int, path string) error
+	CopyCodeBlock(n int) error
+	RunCodeBlock(ctx context.Context, n int) (string, error)
+	GenerateImage(ctx context.Context, prompt string) (string, error)
+	RefineImage(ctx context.Context, instructions string) (string, error)
+	Transcribe(ctx context.Context, path string) (string, error)
+	SetSpeech(on bool) string
+	ListIndexes() []string
+	EnableRAG(index string, topK int) error
+	DisableRAG()
+	ModerationStatus() string
+	SetModeration(stage, mode string) error
 }
 
 // Message represents a chat message
@@ -85,7 +109,7 @@ func formatResponse(success bool, message string, err error) string {
 }
 
 // ExecuteCommand handles command execution with subcommand support
-func (r *CommandRegistry) ExecuteCommand(c ChatClient, input string) string {
+func (r *CommandRegistry) ExecuteCommand(ctx context.Context, c ChatClient, input string) string {
 	if !strings.HasPrefix(input, "/") {
 		return ""
 	}
@@ -106,13 +130,13 @@ func (r *CommandRegistry) ExecuteCommand(c ChatClient, input string) string {
 	}
 
 	if cmd.SubCmds != nil && r.accessLevel >= AccessBeta {
-		return r.executeSubCommand(c, cmd, parts[1:])
+		return r.executeSubCommand(ctx, c, cmd, parts[1:])
 	}
 
-	return cmd.Execute(c, parts[1:])
+	return cmd.Execute(ctx, c, parts[1:])
 }
 
-func (r *CommandRegistry) executeSubCommand(c ChatClient, cmd *Command, args []string) string {
+func (r *CommandRegistry) executeSubCommand(ctx context.Context, c ChatClient, cmd *Command, args []string) string {
 	if len(args) == 0 {
 		return formatResponse(false, "", fmt.Errorf("missing subcommand\n%s", cmd.Help))
 	}
@@ -126,7 +150,19 @@ func (r *CommandRegistry) executeSubCommand(c ChatClient, cmd *Command, args []s
 		return formatResponse(false, "", fmt.Errorf("subcommand %s is not available in current mode", args[0]))
 	}
 
-	return subCmd.Execute(c, args[1:])
+	return subCmd.Execute(ctx, c, args[1:])
+}
+
+// Commands returns the commands available at the current access level,
+// keyed by name, for use in completion
+func (r *CommandRegistry) Commands() map[string]*Command {
+	cmds := make(map[string]*Command)
+	for name, cmd := range r.commands {
+		if cmd.MinAccess <= r.accessLevel {
+			cmds[name] = cmd
+		}
+	}
+	return cmds
 }
 
 // GetHelp returns help information for commands
@@ -160,7 +196,7 @@ func addHelpSubCommand(cmd *Command) {
 		cmd.SubCmds = make(map[string]*Command)
 	}
 	cmd.SubCmds["help"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			return formatResponse(true, cmd.Help, nil)
 		},
 		Help:      "Show help for this command",
@@ -171,7 +207,7 @@ func addHelpSubCommand(cmd *Command) {
 func (r *CommandRegistry) registerCommands() {
 	// Legacy commands (always available)
 	r.commands["/q"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			return formatResponse(true, "Goodbye!", nil)
 		},
 		Help:      "Quit the application",
@@ -179,7 +215,7 @@ func (r *CommandRegistry) registerCommands() {
 	}
 
 	r.commands["/help"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			if len(args) > 0 {
 				return r.GetHelp(args[0])
 			}
@@ -187,6 +223,13 @@ func (r *CommandRegistry) registerCommands() {
 		},
 		Help:      "Show help information. Use /help <command> for detailed help on a command.",
 		MinAccess: AccessLegacy,
+		Complete: func(ctx context.Context, c ChatClient) []string {
+			var names []string
+			for name := range r.Commands() {
+				names = append(names, name)
+			}
+			return names
+		},
 	}
 
 	// Beta commands (new command system)
@@ -242,17 +285,132 @@ func (r *CommandRegistry) registerCommands() {
 	}
 	addHelpSubCommand(r.commands["/conversation"])
 
+	r.commands["/tools"] = &Command{
+		Help: `Tool Commands:
+  list - List the tools the model can call
+  help - Show this help message`,
+		MinAccess: AccessBeta,
+		SubCmds:   make(map[string]*Command),
+	}
+	addHelpSubCommand(r.commands["/tools"])
+
+	r.commands["/file"] = &Command{
+		Help: `File Commands:
+  add <path...> - Attach files to the next message (globs such as ./pkg/**/*.go work)
+  list          - List attached files
+  clear         - Remove all attached files
+  help          - Show this help message`,
+		MinAccess: AccessBeta,
+		SubCmds:   make(map[string]*Command),
+	}
+	addHelpSubCommand(r.commands["/file"])
+
+	r.commands["/code"] = &Command{
+		Help: `Code Block Commands:
+  list [reply]     - List code blocks in the last reply, or in reply N
+  save <n> <path>  - Save code block n to a file
+  copy <n>         - Copy code block n to the clipboard (OSC 52)
+  run <n>          - Run shell code block n after confirmation
+  help             - Show this help message`,
+		MinAccess: AccessBeta,
+		SubCmds:   make(map[string]*Command),
+	}
+	addHelpSubCommand(r.commands["/code"])
+
+	r.commands["/image"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			if len(args) == 0 || args[0] == "help" {
+				return formatResponse(true, r.commands["/image"].Help, nil)
+			}
+			var report string
+			var err error
+			if args[0] == "refine" {
+				if len(args) < 2 {
+					return formatResponse(false, "", fmt.Errorf("usage: /image refine <instructions>"))
+				}
+				report, err = c.RefineImage(ctx, strings.Join(args[1:], " "))
+			} else {
+				report, err = c.GenerateImage(ctx, strings.Join(args, " "))
+			}
+			if err != nil {
+				return formatResponse(false, "", fmt.Errorf("image generation failed: %w", err))
+			}
+			return formatResponse(true, report, nil)
+		},
+		Help: `Image Commands:
+  <prompt>              - Generate an image, using the conversation for context
+  refine <instructions> - Rewrite the last image prompt and generate again
+  help                  - Show this help message
+Images are saved to the gallery (~/.openai/images).`,
+		MinAccess: AccessBeta,
+		Complete: func(ctx context.Context, c ChatClient) []string {
+			return []string{"refine", "help"}
+		},
+	}
+
+	r.commands["/transcribe"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			if len(args) == 0 {
+				return formatResponse(false, "", fmt.Errorf("usage: /transcribe <file>"))
+			}
+			report, err := c.Transcribe(ctx, strings.Join(args, " "))
+			if err != nil {
+				return formatResponse(false, "", err)
+			}
+			return formatResponse(true, report, nil)
+		},
+		Help:      "Transcribe an audio file and add the transcript to the conversation as a user message. Usage: /transcribe <file>",
+		MinAccess: AccessBeta,
+	}
+
+	r.commands["/tts"] = &Command{
+		Help: `Speech Commands:
+  on   - Save each reply as an MP3 next to the conversation
+  off  - Stop saving replies as audio
+  help - Show this help message`,
+		MinAccess: AccessBeta,
+		SubCmds:   make(map[string]*Command),
+	}
+	addHelpSubCommand(r.commands["/tts"])
+
+	r.commands["/rag"] = &Command{
+		Help: `Retrieval Commands:
+  on <index> [k] - Answer from the k most relevant chunks of a local index
+  off            - Stop retrieving context
+  help           - Show this help message`,
+		MinAccess: AccessBeta,
+		SubCmds:   make(map[string]*Command),
+	}
+	addHelpSubCommand(r.commands["/rag"])
+
+	r.commands["/moderation"] = &Command{
+		Help: `Moderation Commands:
+  show          - Show how input and output are checked
+  input <mode>  - Check messages before they are sent: off, warn or block
+  output <mode> - Check replies before they are shown: off, warn or block
+  help          - Show this help message`,
+		MinAccess: AccessBeta,
+		SubCmds:   make(map[string]*Command),
+	}
+	addHelpSubCommand(r.commands["/moderation"])
+
 	// Add all the subcommands after help is added
 	addPersonaCommands(r.commands["/persona"])
 	addSystemCommands(r.commands["/system"])
 	addHistoryCommands(r.commands["/history"])
 	addModelCommands(r.commands["/model"])
 	addConversationCommands(r.commands["/conversation"])
+	addToolCommands(r.commands["/tools"])
+	addFileCommands(r.commands["/file"])
+	addCodeCommands(r.commands["/code"])
+	addSpeechCommands(r.commands["/tts"])
+	addRAGCommands(r.commands["/rag"])
+	addModerationCommands(r.commands["/moderation"])
 }
 
 func addPersonaCommands(cmd *Command) {
 	cmd.SubCmds["list"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			personas := c.ListPersonas()
 			currentPersona := c.GetCurrentPersona()
 			for i, p := range personas {
@@ -266,7 +424,7 @@ func addPersonaCommands(cmd *Command) {
 		MinAccess: AccessBeta,
 	}
 	cmd.SubCmds["show"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			persona := c.ShowPersona()
 			return formatResponse(true, persona, nil)
 		},
@@ -274,7 +432,7 @@ func addPersonaCommands(cmd *Command) {
 		MinAccess: AccessBeta,
 	}
 	cmd.SubCmds["save"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			if len(args) < 1 {
 				return formatResponse(false, "", fmt.Errorf("usage: /persona save <name>"))
 			}
@@ -285,9 +443,12 @@ func addPersonaCommands(cmd *Command) {
 		},
 		Help:      "Saves the current system directive as a persona",
 		MinAccess: AccessBeta,
+		Complete: func(ctx context.Context, c ChatClient) []string {
+			return c.ListPersonas()
+		},
 	}
 	cmd.SubCmds["load"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			if len(args) < 1 {
 				return formatResponse(false, "", fmt.Errorf("usage: /persona load <name>"))
 			}
@@ -298,12 +459,15 @@ func addPersonaCommands(cmd *Command) {
 		},
 		Help:      "Loads a persona by name",
 		MinAccess: AccessBeta,
+		Complete: func(ctx context.Context, c ChatClient) []string {
+			return c.ListPersonas()
+		},
 	}
 }
 
 func addSystemCommands(cmd *Command) {
 	cmd.SubCmds["directive"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			if len(args) < 1 {
 				return formatResponse(false, "", fmt.Errorf("usage: /system directive <text>"))
 			}
@@ -320,7 +484,7 @@ func addSystemCommands(cmd *Command) {
 
 func addHistoryCommands(cmd *Command) {
 	cmd.SubCmds["show"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			var hist []string
 			for _, m := range c.GetHistory() {
 				hist = append(hist, fmt.Sprintf("%s: %s", m.Role, m.Content))
@@ -331,7 +495,7 @@ func addHistoryCommands(cmd *Command) {
 		MinAccess: AccessBeta,
 	}
 	cmd.SubCmds["clear"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			c.ClearHistory()
 			return formatResponse(true, "History cleared", nil)
 		},
@@ -342,15 +506,18 @@ func addHistoryCommands(cmd *Command) {
 
 func addModelCommands(cmd *Command) {
 	cmd.SubCmds["list"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
-			models := c.ListModels()
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			models, err := c.ListModels(ctx)
+			if err != nil {
+				return formatResponse(false, "", err)
+			}
 			return formatResponse(true, strings.Join(models, "\n"), nil)
 		},
 		Help:      "Lists available models",
 		MinAccess: AccessBeta,
 	}
 	cmd.SubCmds["set"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			if len(args) < 1 {
 				return formatResponse(false, "", fmt.Errorf("usage: /model set <name>"))
 			}
@@ -359,12 +526,17 @@ func addModelCommands(cmd *Command) {
 		},
 		Help:      "Sets the current model",
 		MinAccess: AccessBeta,
+		Complete: func(ctx context.Context, c ChatClient) []string {
+			models, _ := c.ListModels(ctx)
+			return models
+		},
+		CompleteRemote: true,
 	}
 }
 
 func addConversationCommands(cmd *Command) {
 	cmd.SubCmds["list"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			convos := c.ListConversations()
 			return formatResponse(true, strings.Join(convos, "\n"), nil)
 		},
@@ -372,7 +544,7 @@ func addConversationCommands(cmd *Command) {
 		MinAccess: AccessBeta,
 	}
 	cmd.SubCmds["save"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			if len(args) < 1 {
 				return formatResponse(false, "", fmt.Errorf("usage: /conversation save <name>"))
 			}
@@ -383,9 +555,12 @@ func addConversationCommands(cmd *Command) {
 		},
 		Help:      "Saves the current conversation",
 		MinAccess: AccessBeta,
+		Complete: func(ctx context.Context, c ChatClient) []string {
+			return c.ListConversations()
+		},
 	}
 	cmd.SubCmds["load"] = &Command{
-		Execute: func(c ChatClient, args []string) string {
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
 			if len(args) < 1 {
 				return formatResponse(false, "", fmt.Errorf("usage: /conversation load <name>"))
 			}
@@ -396,5 +571,222 @@ func addConversationCommands(cmd *Command) {
 		},
 		Help:      "Loads a saved conversation",
 		MinAccess: AccessBeta,
+		Complete: func(ctx context.Context, c ChatClient) []string {
+			return c.ListConversations()
+		},
+	}
+}
+
+func addToolCommands(cmd *Command) {
+	cmd.SubCmds["list"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			tools := c.ListTools()
+			if len(tools) == 0 {
+				return formatResponse(true, "No tools enabled", nil)
+			}
+			return formatResponse(true, strings.Join(tools, "\n"), nil)
+		},
+		Help:      "Lists the tools the model can call",
+		MinAccess: AccessBeta,
+	}
+}
+
+func addFileCommands(cmd *Command) {
+	cmd.SubCmds["add"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			if len(args) < 1 {
+				return formatResponse(false, "", fmt.Errorf("usage: /file add <path...>"))
+			}
+			report, err := c.AttachFiles(args)
+			if err != nil {
+				return formatResponse(false, "", fmt.Errorf("failed to attach files: %w", err))
+			}
+			return formatResponse(true, strings.Join(report, "\n"), nil)
+		},
+		Help:      "Attaches files to the next message",
+		MinAccess: AccessBeta,
+	}
+	cmd.SubCmds["list"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			files := c.ListAttachments()
+			if len(files) == 0 {
+				return formatResponse(true, "No files attached", nil)
+			}
+			return formatResponse(true, strings.Join(files, "\n"), nil)
+		},
+		Help:      "Lists attached files",
+		MinAccess: AccessBeta,
+	}
+	cmd.SubCmds["clear"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			c.ClearAttachments()
+			return formatResponse(true, "Attachments cleared", nil)
+		},
+		Help:      "Removes all attached files",
+		MinAccess: AccessBeta,
+	}
+}
+
+// parseBlockNumber parses the code block number given to a /code subcommand.
+func parseBlockNumber(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid code block number: %s", arg)
+	}
+	return n, nil
+}
+
+func addCodeCommands(cmd *Command) {
+	cmd.SubCmds["list"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			reply := 0
+			if len(args) > 0 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return formatResponse(false, "", fmt.Errorf("invalid reply number: %s", args[0]))
+				}
+				reply = n
+			}
+			blocks, err := c.ListCodeBlocks(reply)
+			if err != nil {
+				return formatResponse(false, "", err)
+			}
+			return formatResponse(true, strings.Join(blocks, "\n"), nil)
+		},
+		Help:      "Lists code blocks in the last reply, or in reply N",
+		MinAccess: AccessBeta,
+	}
+	cmd.SubCmds["save"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			if len(args) < 2 {
+				return formatResponse(false, "", fmt.Errorf("usage: /code save <n> <path>"))
+			}
+			n, err := parseBlockNumber(args[0])
+			if err != nil {
+				return formatResponse(false, "", err)
+			}
+			if err := c.SaveCodeBlock(n, args[1]); err != nil {
+				return formatResponse(false, "", fmt.Errorf("failed to save code block: %w", err))
+			}
+			return formatResponse(true, fmt.Sprintf("Code block %d saved to %s", n, args[1]), nil)
+		},
+		Help:      "Saves a code block to a file",
+		MinAccess: AccessBeta,
+	}
+	cmd.SubCmds["copy"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			if len(args) < 1 {
+				return formatResponse(false, "", fmt.Errorf("usage: /code copy <n>"))
+			}
+			n, err := parseBlockNumber(args[0])
+			if err != nil {
+				return formatResponse(false, "", err)
+			}
+			if err := c.CopyCodeBlock(n); err != nil {
+				return formatResponse(false, "", fmt.Errorf("failed to copy code block: %w", err))
+			}
+			return formatResponse(true, fmt.Sprintf("Code block %d copied to the clipboard", n), nil)
+		},
+		Help:      "Copies a code block to the clipboard",
+		MinAccess: AccessBeta,
+	}
+	cmd.SubCmds["run"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			if len(args) < 1 {
+				return formatResponse(false, "", fmt.Errorf("usage: /code run <n>"))
+			}
+			n, err := parseBlockNumber(args[0])
+			if err != nil {
+				return formatResponse(false, "", err)
+			}
+			output, err := c.RunCodeBlock(ctx, n)
+			if err != nil {
+				return formatResponse(false, "", fmt.Errorf("failed to run code block: %w", err))
+			}
+			return formatResponse(true, output, nil)
+		},
+		Help:      "Runs a shell code block after confirmation",
+		MinAccess: AccessBeta,
+	}
+}
+
+func addSpeechCommands(cmd *Command) {
+	cmd.SubCmds["on"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			return formatResponse(true, c.SetSpeech(true), nil)
+		},
+		Help:      "Saves each reply as audio",
+		MinAccess: AccessBeta,
+	}
+	cmd.SubCmds["off"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			return formatResponse(true, c.SetSpeech(false), nil)
+		},
+		Help:      "Stops saving replies as audio",
+		MinAccess: AccessBeta,
+	}
+}
+
+func addRAGCommands(cmd *Command) {
+	cmd.SubCmds["on"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			if len(args) < 1 {
+				return formatResponse(false, "", fmt.Errorf("usage: /rag on <index> [k]"))
+			}
+			k := 0
+			if len(args) > 1 {
+				n, err := strconv.Atoi(args[1])
+				if err != nil || n < 1 {
+					return formatResponse(false, "", fmt.Errorf("invalid number of chunks: %s", args[1]))
+				}
+				k = n
+			}
+			if err := c.EnableRAG(args[0], k); err != nil {
+				return formatResponse(false, "", err)
+			}
+			return formatResponse(true, fmt.Sprintf("Answering from index %s", args[0]), nil)
+		},
+		Help:      "Retrieves context from a local index for each message",
+		MinAccess: AccessBeta,
+		Complete: func(ctx context.Context, c ChatClient) []string {
+			return c.ListIndexes()
+		},
+	}
+	cmd.SubCmds["off"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			c.DisableRAG()
+			return formatResponse(true, "Retrieval off", nil)
+		},
+		Help:      "Stops retrieving context",
+		MinAccess: AccessBeta,
+	}
+}
+
+func addModerationCommands(cmd *Command) {
+	cmd.SubCmds["show"] = &Command{
+		Execute: func(ctx context.Context, c ChatClient, args []string) string {
+			return formatResponse(true, c.ModerationStatus(), nil)
+		},
+		Help:      "Shows the moderation settings in force",
+		MinAccess: AccessBeta,
+	}
+	for _, stage := range []string{"input", "output"} {
+		stage := stage
+		cmd.SubCmds[stage] = &Command{
+			Execute: func(ctx context.Context, c ChatClient, args []string) string {
+				if len(args) != 1 {
+					return formatResponse(false, "", fmt.Errorf("usage: /moderation %s off|warn|block", stage))
+				}
+				if err := c.SetModeration(stage, args[0]); err != nil {
+					return formatResponse(false, "", err)
+				}
+				return formatResponse(true, fmt.Sprintf("Moderation of %s: %s", stage, args[0]), nil)
+			},
+			Help:      fmt.Sprintf("Sets how %s is moderated for this session", stage),
+			MinAccess: AccessBeta,
+			Complete: func(ctx context.Context, c ChatClient) []string {
+				return []string{"off", "warn", "block"}
+			},
+		}
 	}
 }
@@ -0,0 +1,88 @@
+package fakeapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// handleAudio serves transcriptions and translations. The "transcript"
+// names the uploaded file and echoes the prompt and language, so tests can
+// see what was sent.
+func (s *Server) handleAudio(task string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		fh, err := g.FormFile("file")
+		if err != nil {
+			apiError(g, http.StatusBadRequest, "missing file: %s", err.Error())
+			return
+		}
+		if fh.Size > 25<<20 {
+			apiError(g, http.StatusBadRequest, "file must be less than 25 MB")
+			return
+		}
+		if g.PostForm("model") == "" {
+			apiError(g, http.StatusBadRequest, "model is required")
+			return
+		}
+
+		language := g.PostForm("language")
+		if language == "" || task == "translate" {
+			language = "english"
+		}
+		kind := "transcription"
+		if task == "translate" {
+			kind = "translation"
+		}
+		text := fmt.Sprintf("This is a %s of %s (%d bytes).", kind, fh.Filename, fh.Size)
+		if prompt := g.PostForm("prompt"); prompt != "" {
+			text += " Prompt: " + prompt
+		}
+
+		switch openai.AudioResponseFormat(g.PostForm("response_format")) {
+		case "", openai.AudioResponseFormatJSON:
+			g.JSON(http.StatusOK, gin.H{"text": text})
+		case openai.AudioResponseFormatVerboseJSON:
+			g.JSON(http.StatusOK, gin.H{
+				"task":     task,
+				"language": language,
+				"duration": 2.0,
+				"text":     text,
+				"segments": []gin.H{{"id": 0, "start": 0.0, "end": 2.0, "text": text}},
+			})
+		case openai.AudioResponseFormatText:
+			g.String(http.StatusOK, "%s\n", text)
+		case openai.AudioResponseFormatSRT:
+			g.String(http.StatusOK, "1\n00:00:00,000 --> 00:00:02,000\n%s\n\n", text)
+		case openai.AudioResponseFormatVTT:
+			g.String(http.StatusOK, "WEBVTT\n\n00:00:00.000 --> 00:00:02.000\n%s\n\n", text)
+		default:
+			apiError(g, http.StatusBadRequest, "unsupported response_format: %s", g.PostForm("response_format"))
+		}
+	}
+}
+
+// handleSpeech returns a placeholder "audio" file that names the voice and
+// format and repeats the input, so callers can check what was spoken.
+func (s *Server) handleSpeech(g *gin.Context) {
+	var req openai.CreateSpeechRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		apiError(g, http.StatusBadRequest, "invalid request: %s", err.Error())
+		return
+	}
+	if req.Input == "" || req.Model == "" || req.Voice == "" {
+		apiError(g, http.StatusBadRequest, "model, input and voice are required")
+		return
+	}
+	if len([]rune(req.Input)) > 4096 {
+		apiError(g, http.StatusBadRequest, "input must be at most 4096 characters")
+		return
+	}
+	format := req.ResponseFormat
+	if format == "" {
+		format = openai.SpeechResponseFormatMp3
+	}
+	g.Data(http.StatusOK, "audio/"+string(format),
+		[]byte(fmt.Sprintf("fake %s audio, voice %s\n%s\n", format, req.Voice, req.Input)))
+}
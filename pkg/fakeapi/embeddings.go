@@ -0,0 +1,81 @@
+package fakeapi
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// fakeEmbeddingDims is the length of the fake's embeddings.
+const fakeEmbeddingDims = 256
+
+// fakeEmbedding hashes the words of text into a normalised bag-of-words
+// vector, so texts sharing words come out similar.
+func fakeEmbedding(text string) []float32 {
+	v := make([]float32, fakeEmbeddingDims)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		h := fnv.New32a()
+		h.Write([]byte(w))
+		v[h.Sum32()%fakeEmbeddingDims]++
+	}
+	var norm float64
+	for _, x := range v {
+		norm += float64(x * x)
+	}
+	if norm > 0 {
+		for i := range v {
+			v[i] /= float32(math.Sqrt(norm))
+		}
+	}
+	return v
+}
+
+func (s *Server) handleEmbeddings(g *gin.Context) {
+	var req struct {
+		Input any    `json:"input"`
+		Model string `json:"model"`
+	}
+	if err := g.ShouldBindJSON(&req); err != nil {
+		apiError(g, http.StatusBadRequest, "invalid request: %s", err.Error())
+		return
+	}
+	var inputs []string
+	switch in := req.Input.(type) {
+	case string:
+		inputs = []string{in}
+	case []any:
+		for _, v := range in {
+			text, ok := v.(string)
+			if !ok {
+				apiError(g, http.StatusBadRequest, "input must be a string or an array of strings")
+				return
+			}
+			inputs = append(inputs, text)
+		}
+	}
+	if len(inputs) == 0 || req.Model == "" {
+		apiError(g, http.StatusBadRequest, "model and input are required")
+		return
+	}
+
+	resp := openai.EmbeddingResponse{Object: "list", Model: openai.EmbeddingModel(req.Model)}
+	for i, text := range inputs {
+		if text == "" {
+			apiError(g, http.StatusBadRequest, "input %d is empty", i)
+			return
+		}
+		resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: fakeEmbedding(text)})
+		tokens := len(strings.Fields(text))
+		resp.Usage.PromptTokens += tokens
+		resp.Usage.TotalTokens += tokens
+	}
+	g.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,457 @@
+// Package fakeapi provides a local stand-in for the parts of the OpenAI API
+// used by the CLI. Point the client at it with OPENAI_BASE_URL to exercise
+// uploads, batch jobs, fine-tuning jobs, chat completions, images, audio,
+// embeddings and moderation without network access or cost.
+package fakeapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Server holds the in-memory state of the fake API.
+type Server struct {
+	// StreamDelay is the pause between streamed chunks, useful for
+	// exercising cancellation.
+	StreamDelay time.Duration
+
+	mu      sync.Mutex
+	nextID  int
+	files   map[string]openai.File
+	content map[string][]byte
+	batches map[string]*openai.Batch
+	images  map[string][]byte
+	jobs    map[string]*fineTuningJob
+	models  []string // fine-tuned models, listed after the base models
+}
+
+// NewServer creates an empty fake API server.
+func NewServer() *Server {
+	return &Server{
+		files:   make(map[string]openai.File),
+		content: make(map[string][]byte),
+		batches: make(map[string]*openai.Batch),
+		images:  make(map[string][]byte),
+		jobs:    make(map[string]*fineTuningJob),
+	}
+}
+
+// Handler returns the HTTP handler serving the API under /v1.
+func (s *Server) Handler() http.Handler {
+	r := gin.New()
+	v1 := r.Group("/v1")
+	v1.GET("/models", s.handleListModels)
+	v1.POST("/chat/completions", s.handleChatCompletion)
+	v1.POST("/files", s.handleUploadFile)
+	v1.GET("/files", s.handleListFiles)
+	v1.GET("/files/:id", s.handleGetFile)
+	v1.GET("/files/:id/content", s.handleFileContent)
+	v1.DELETE("/files/:id", s.handleDeleteFile)
+	v1.POST("/batches", s.handleCreateBatch)
+	v1.GET("/batches", s.handleListBatches)
+	v1.GET("/batches/:id", s.handleGetBatch)
+	v1.POST("/batches/:id/cancel", s.handleCancelBatch)
+	v1.POST("/images/generations", s.handleCreateImage)
+	v1.POST("/images/edits", s.handleImageUpload)
+	v1.POST("/images/variations", s.handleImageUpload)
+	v1.GET("/images/content/:id", s.handleImageContent)
+	v1.POST("/audio/transcriptions", s.handleAudio("transcribe"))
+	v1.POST("/audio/translations", s.handleAudio("translate"))
+	v1.POST("/audio/speech", s.handleSpeech)
+	v1.POST("/embeddings", s.handleEmbeddings)
+	v1.POST("/moderations", s.handleModerations)
+	v1.POST("/fine_tuning/jobs", s.handleCreateFineTuningJob)
+	v1.GET("/fine_tuning/jobs", s.handleListFineTuningJobs)
+	v1.GET("/fine_tuning/jobs/:id", s.handleGetFineTuningJob)
+	v1.POST("/fine_tuning/jobs/:id/cancel", s.handleCancelFineTuningJob)
+	v1.GET("/fine_tuning/jobs/:id/events", s.handleFineTuningEvents)
+	return r
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func apiError(g *gin.Context, status int, format string, args ...any) {
+	g.JSON(status, gin.H{"error": gin.H{
+		"message": fmt.Sprintf(format, args...),
+		"type":    "invalid_request_error",
+	}})
+}
+
+func (s *Server) handleListModels(g *gin.Context) {
+	models := []gin.H{
+		{"id": "gpt-4", "object": "model", "owned_by": "fakeapi"},
+		{"id": "gpt-3.5-turbo", "object": "model", "owned_by": "fakeapi"},
+	}
+	s.mu.Lock()
+	for _, id := range s.models {
+		models = append(models, gin.H{"id": id, "object": "model", "owned_by": "user-fakeapi"})
+	}
+	s.mu.Unlock()
+	g.JSON(http.StatusOK, gin.H{"object": "list", "data": models})
+}
+
+// complete answers a chat request by echoing the last user message. When
+// tools are offered and the message reads "call <tool> <json arguments>",
+// it requests that tool call instead, and it answers a tool result with
+// "tool result: <content>".
+func complete(req openai.ChatCompletionRequest) openai.ChatCompletionResponse {
+	var prompt string
+	for _, m := range req.Messages {
+		if m.Role == openai.ChatMessageRoleUser {
+			prompt = m.Content
+		}
+	}
+	answer := "echo: " + prompt
+
+	var toolCalls []openai.ToolCall
+	last := req.Messages[len(req.Messages)-1]
+	switch {
+	case last.Role == openai.ChatMessageRoleTool:
+		answer = "tool result: " + last.Content
+	case len(req.Tools) > 0 && strings.HasPrefix(prompt, "call "):
+		name, args, _ := strings.Cut(strings.TrimPrefix(prompt, "call "), " ")
+		toolCalls = []openai.ToolCall{{
+			ID:       fmt.Sprintf("call_%d", time.Now().UnixNano()),
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: name, Arguments: args},
+		}}
+		answer = ""
+	}
+
+	promptTokens := 0
+	for _, m := range req.Messages {
+		promptTokens += len(strings.Fields(m.Content))
+	}
+	completionTokens := len(strings.Fields(answer))
+
+	finish := openai.FinishReasonStop
+	if len(toolCalls) > 0 {
+		finish = openai.FinishReasonToolCalls
+	}
+
+	return openai.ChatCompletionResponse{
+		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   answer,
+				ToolCalls: toolCalls,
+			},
+			FinishReason: finish,
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}
+}
+
+func (s *Server) handleChatCompletion(g *gin.Context) {
+	var req openai.ChatCompletionRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		apiError(g, http.StatusBadRequest, "invalid request: %s", err.Error())
+		return
+	}
+	resp := complete(req)
+	if !req.Stream {
+		g.JSON(http.StatusOK, resp)
+		return
+	}
+
+	// Stream the answer one word at a time as server-sent events.
+	g.Header("Content-Type", "text/event-stream")
+	if calls := resp.Choices[0].Message.ToolCalls; len(calls) > 0 {
+		for i := range calls {
+			index := i
+			calls[i].Index = &index
+		}
+		b, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:    resp.ID,
+			Model: resp.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Delta:        openai.ChatCompletionStreamChoiceDelta{ToolCalls: calls},
+				FinishReason: openai.FinishReasonToolCalls,
+			}},
+		})
+		fmt.Fprintf(g.Writer, "data: %s\n\n", b)
+		streamUsage(g, req, resp)
+		return
+	}
+
+	words := strings.SplitAfter(resp.Choices[0].Message.Content, " ")
+	for i, w := range words {
+		chunk := openai.ChatCompletionStreamResponse{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Created: resp.Created,
+			Model:   resp.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Delta: openai.ChatCompletionStreamChoiceDelta{Content: w},
+			}},
+		}
+		if i == len(words)-1 {
+			chunk.Choices[0].FinishReason = openai.FinishReasonStop
+		}
+		b, _ := json.Marshal(chunk)
+		fmt.Fprintf(g.Writer, "data: %s\n\n", b)
+		g.Writer.Flush()
+		if s.StreamDelay > 0 {
+			time.Sleep(s.StreamDelay)
+		}
+	}
+	streamUsage(g, req, resp)
+}
+
+// streamUsage ends a stream, first sending the usage chunk when the request
+// asked for it with stream_options.
+func streamUsage(g *gin.Context, req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) {
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		b, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Created: resp.Created,
+			Model:   resp.Model,
+			Choices: []openai.ChatCompletionStreamChoice{},
+			Usage:   &resp.Usage,
+		})
+		fmt.Fprintf(g.Writer, "data: %s\n\n", b)
+	}
+	fmt.Fprint(g.Writer, "data: [DONE]\n\n")
+}
+
+func (s *Server) handleUploadFile(g *gin.Context) {
+	fh, err := g.FormFile("file")
+	if err != nil {
+		apiError(g, http.StatusBadRequest, "missing file: %s", err.Error())
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		apiError(g, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		apiError(g, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g.JSON(http.StatusOK, s.addFile(fh.Filename, g.PostForm("purpose"), b))
+}
+
+// addFile stores a file. The caller must hold s.mu.
+func (s *Server) addFile(name, purpose string, b []byte) openai.File {
+	file := openai.File{
+		ID:        s.newID("file"),
+		Object:    "file",
+		Bytes:     len(b),
+		CreatedAt: time.Now().Unix(),
+		FileName:  name,
+		Purpose:   purpose,
+		Status:    "processed",
+	}
+	s.files[file.ID] = file
+	s.content[file.ID] = b
+	return file
+}
+
+func (s *Server) handleListFiles(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := []openai.File{}
+	for _, f := range s.files {
+		files = append(files, f)
+	}
+	g.JSON(http.StatusOK, gin.H{"object": "list", "data": files})
+}
+
+func (s *Server) handleGetFile(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[g.Param("id")]
+	if !ok {
+		apiError(g, http.StatusNotFound, "no such file: %s", g.Param("id"))
+		return
+	}
+	g.JSON(http.StatusOK, f)
+}
+
+func (s *Server) handleFileContent(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.content[g.Param("id")]
+	if !ok {
+		apiError(g, http.StatusNotFound, "no such file: %s", g.Param("id"))
+		return
+	}
+	g.Data(http.StatusOK, "application/octet-stream", b)
+}
+
+func (s *Server) handleDeleteFile(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := g.Param("id")
+	if _, ok := s.files[id]; !ok {
+		apiError(g, http.StatusNotFound, "no such file: %s", id)
+		return
+	}
+	delete(s.files, id)
+	delete(s.content, id)
+	g.JSON(http.StatusOK, gin.H{"id": id, "object": "file", "deleted": true})
+}
+
+func (s *Server) handleCreateBatch(g *gin.Context) {
+	var req openai.CreateBatchRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		apiError(g, http.StatusBadRequest, "invalid request: %s", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.content[req.InputFileID]; !ok {
+		apiError(g, http.StatusBadRequest, "no such file: %s", req.InputFileID)
+		return
+	}
+	batch := &openai.Batch{
+		ID:               s.newID("batch"),
+		Object:           "batch",
+		Endpoint:         req.Endpoint,
+		InputFileID:      req.InputFileID,
+		CompletionWindow: req.CompletionWindow,
+		Status:           "validating",
+		CreatedAt:        int(time.Now().Unix()),
+		Metadata:         req.Metadata,
+	}
+	s.batches[batch.ID] = batch
+	g.JSON(http.StatusOK, batch)
+}
+
+func (s *Server) handleListBatches(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batches := []openai.Batch{}
+	for _, b := range s.batches {
+		batches = append(batches, *b)
+	}
+	g.JSON(http.StatusOK, gin.H{"object": "list", "data": batches})
+}
+
+// handleGetBatch moves the batch one step through its lifecycle on every
+// poll, so clients see validating, in_progress and then completed.
+func (s *Server) handleGetBatch(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.batches[g.Param("id")]
+	if !ok {
+		apiError(g, http.StatusNotFound, "no such batch: %s", g.Param("id"))
+		return
+	}
+
+	now := int(time.Now().Unix())
+	switch batch.Status {
+	case "validating":
+		batch.Status = "in_progress"
+		batch.InProgressAt = &now
+	case "in_progress":
+		s.runBatch(batch)
+		batch.Status = "completed"
+		batch.CompletedAt = &now
+	case "cancelling":
+		batch.Status = "cancelled"
+		batch.CancelledAt = &now
+	}
+	g.JSON(http.StatusOK, batch)
+}
+
+func (s *Server) handleCancelBatch(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.batches[g.Param("id")]
+	if !ok {
+		apiError(g, http.StatusNotFound, "no such batch: %s", g.Param("id"))
+		return
+	}
+	if batch.Status == "validating" || batch.Status == "in_progress" {
+		now := int(time.Now().Unix())
+		batch.Status = "cancelling"
+		batch.CancellingAt = &now
+	}
+	g.JSON(http.StatusOK, batch)
+}
+
+// batchOutputLine is one line of a batch output or error file.
+type batchOutputLine struct {
+	ID       string         `json:"id"`
+	CustomID string         `json:"custom_id"`
+	Response *batchResponse `json:"response"`
+	Error    *batchError    `json:"error"`
+}
+
+// batchResponse is the API response recorded for a batch request.
+type batchResponse struct {
+	StatusCode int                           `json:"status_code"`
+	RequestID  string                        `json:"request_id"`
+	Body       openai.ChatCompletionResponse `json:"body"`
+}
+
+// batchError describes a batch request that could not be processed.
+type batchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// runBatch answers every line of the batch input file and stores the output
+// and error files. The caller must hold s.mu.
+func (s *Server) runBatch(batch *openai.Batch) {
+	var output, failures bytes.Buffer
+	lines := strings.Split(strings.TrimSpace(string(s.content[batch.InputFileID])), "\n")
+	for i, line := range lines {
+		var item openai.BatchChatCompletionRequest
+		out := batchOutputLine{ID: fmt.Sprintf("batch_req_%d", i+1)}
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			out.Error = &batchError{Code: "invalid_json", Message: err.Error()}
+			b, _ := json.Marshal(out)
+			failures.Write(append(b, '\n'))
+			batch.RequestCounts.Failed++
+			continue
+		}
+
+		out.CustomID = item.CustomID
+		out.Response = &batchResponse{
+			StatusCode: http.StatusOK,
+			RequestID:  fmt.Sprintf("req_%d", i+1),
+			Body:       complete(item.Body),
+		}
+		b, _ := json.Marshal(out)
+		output.Write(append(b, '\n'))
+		batch.RequestCounts.Completed++
+	}
+	batch.RequestCounts.Total = len(lines)
+
+	outFile := s.addFile(batch.ID+"_output.jsonl", "batch_output", output.Bytes())
+	batch.OutputFileID = &outFile.ID
+	if failures.Len() > 0 {
+		errFile := s.addFile(batch.ID+"_error.jsonl", "batch_output", failures.Bytes())
+		batch.ErrorFileID = &errFile.ID
+	}
+}
@@ -0,0 +1,89 @@
+package fakeapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TestBatchLifecycle uploads a batch input file, creates a batch, polls it
+// until it completes and downloads the results.
+func TestBatchLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	srv := httptest.NewServer(NewServer().Handler())
+	defer srv.Close()
+	config := openai.DefaultConfig("test")
+	config.BaseURL = srv.URL + "/v1"
+	client := openai.NewClientWithConfig(config)
+	ctx := context.Background()
+
+	upload := openai.UploadBatchFileRequest{FileName: "requests.jsonl"}
+	prompts := map[string]string{"first": "hello", "second": "goodbye"}
+	for id, prompt := range prompts {
+		upload.AddChatCompletion(id, openai.ChatCompletionRequest{
+			Model:    openai.GPT4,
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+		})
+	}
+	file, err := client.UploadBatchFile(ctx, upload)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if file.Purpose != string(openai.PurposeBatch) {
+		t.Errorf("file purpose = %q, want %q", file.Purpose, openai.PurposeBatch)
+	}
+
+	batch, err := client.CreateBatch(ctx, openai.CreateBatchRequest{
+		InputFileID: file.ID,
+		Endpoint:    openai.BatchEndpointChatCompletions,
+	})
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+
+	var statuses []string
+	for i := 0; i < 5 && batch.Status != "completed"; i++ {
+		batch, err = client.RetrieveBatch(ctx, batch.ID)
+		if err != nil {
+			t.Fatalf("retrieve batch: %v", err)
+		}
+		statuses = append(statuses, batch.Status)
+	}
+	if batch.Status != "completed" {
+		t.Fatalf("batch went through %v without completing", statuses)
+	}
+	if batch.OutputFileID == nil {
+		t.Fatal("completed batch has no output file")
+	}
+	if batch.RequestCounts.Completed != len(prompts) {
+		t.Errorf("completed requests = %d, want %d", batch.RequestCounts.Completed, len(prompts))
+	}
+
+	content, err := client.GetFileContent(ctx, *batch.OutputFileID)
+	if err != nil {
+		t.Fatalf("download output: %v", err)
+	}
+	defer content.Close()
+	answers := map[string]string{}
+	sc := bufio.NewScanner(content)
+	for sc.Scan() {
+		var line batchOutputLine
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatalf("invalid output line %q: %v", sc.Text(), err)
+		}
+		if line.Response == nil || len(line.Response.Body.Choices) == 0 {
+			t.Fatalf("output line for %s has no response", line.CustomID)
+		}
+		answers[line.CustomID] = line.Response.Body.Choices[0].Message.Content
+	}
+	for id, prompt := range prompts {
+		if want := "echo: " + prompt; answers[id] != want {
+			t.Errorf("answer for %s = %q, want %q", id, answers[id], want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package fakeapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// fineTuningJob is a job and its events, newest last.
+type fineTuningJob struct {
+	openai.FineTuningJob
+	seq    int // creation order, for listing newest first
+	suffix string
+	events []openai.FineTuneEvent
+}
+
+// event records a job event. The caller must hold s.mu.
+func (j *fineTuningJob) event(level, message string) {
+	j.events = append(j.events, openai.FineTuneEvent{
+		Object:    "fine_tuning.job.event",
+		CreatedAt: time.Now().Unix(),
+		Level:     level,
+		Message:   message,
+	})
+}
+
+func (s *Server) handleCreateFineTuningJob(g *gin.Context) {
+	var req openai.FineTuningJobRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		apiError(g, http.StatusBadRequest, "invalid request: %s", err.Error())
+		return
+	}
+	if req.Model == "" {
+		apiError(g, http.StatusBadRequest, "model is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := []string{req.TrainingFile}
+	if req.ValidationFile != "" {
+		files = append(files, req.ValidationFile)
+	}
+	for _, id := range files {
+		if f, ok := s.files[id]; !ok || f.Purpose != string(openai.PurposeFineTune) {
+			apiError(g, http.StatusBadRequest, "no fine-tune file %q", id)
+			return
+		}
+	}
+	job := &fineTuningJob{seq: len(s.jobs), suffix: req.Suffix, FineTuningJob: openai.FineTuningJob{
+		ID:              s.newID("ftjob"),
+		Object:          "fine_tuning.job",
+		CreatedAt:       time.Now().Unix(),
+		Model:           req.Model,
+		Status:          "validating_files",
+		TrainingFile:    req.TrainingFile,
+		ValidationFile:  req.ValidationFile,
+		ResultFiles:     []string{},
+		Hyperparameters: openai.Hyperparameters{Epochs: "auto"},
+	}}
+	if req.Hyperparameters != nil && req.Hyperparameters.Epochs != nil {
+		job.Hyperparameters.Epochs = req.Hyperparameters.Epochs
+	}
+	job.event("info", "Validating training file: "+req.TrainingFile)
+	s.jobs[job.ID] = job
+	g.JSON(http.StatusOK, job.FineTuningJob)
+}
+
+func (s *Server) handleListFineTuningJobs(g *gin.Context) {
+	limit, err := strconv.Atoi(g.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		apiError(g, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make([]*fineTuningJob, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		all = append(all, j)
+	}
+	sort.Slice(all, func(i, k int) bool { return all[i].seq > all[k].seq })
+	jobs := []openai.FineTuningJob{}
+	for _, j := range all {
+		jobs = append(jobs, j.FineTuningJob)
+	}
+	more := len(jobs) > limit
+	if more {
+		jobs = jobs[:limit]
+	}
+	g.JSON(http.StatusOK, gin.H{"object": "list", "data": jobs, "has_more": more})
+}
+
+// handleGetFineTuningJob moves the job one step through its lifecycle on
+// every poll, so clients see validating_files, queued, running and then
+// succeeded.
+func (s *Server) handleGetFineTuningJob(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[g.Param("id")]
+	if !ok {
+		apiError(g, http.StatusNotFound, "no such fine-tuning job: %s", g.Param("id"))
+		return
+	}
+
+	switch job.Status {
+	case "validating_files":
+		job.Status = "queued"
+		job.event("info", "Files validated, moving job to queued state")
+	case "queued":
+		job.Status = "running"
+		job.event("info", "Fine-tuning job started")
+	case "running":
+		s.finishFineTuningJob(job)
+	}
+	g.JSON(http.StatusOK, job.FineTuningJob)
+}
+
+// finishFineTuningJob completes a job, naming its model the way the API
+// does and writing a results file. The caller must hold s.mu.
+func (s *Server) finishFineTuningJob(job *fineTuningJob) {
+	tokens := len(strings.Fields(string(s.content[job.TrainingFile])))
+	name := "ft:" + job.Model + ":fakeapi"
+	if job.suffix != "" {
+		name += ":" + job.suffix
+	}
+	results := s.addFile("step_metrics.csv", string(openai.PurposeFineTuneResults),
+		[]byte("step,train_loss\n1,1.20\n2,0.85\n3,0.61\n"))
+
+	job.Status = "succeeded"
+	job.FinishedAt = time.Now().Unix()
+	job.FineTunedModel = name + ":" + strings.TrimPrefix(job.ID, "ftjob-")
+	job.TrainedTokens = tokens
+	job.ResultFiles = []string{results.ID}
+	job.event("info", "Step 3/3: training loss=0.61")
+	job.event("info", "New fine-tuned model created: "+job.FineTunedModel)
+	job.event("info", "The job has successfully completed")
+	s.models = append(s.models, job.FineTunedModel)
+}
+
+func (s *Server) handleCancelFineTuningJob(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[g.Param("id")]
+	if !ok {
+		apiError(g, http.StatusNotFound, "no such fine-tuning job: %s", g.Param("id"))
+		return
+	}
+	switch job.Status {
+	case "succeeded", "failed", "cancelled":
+		apiError(g, http.StatusBadRequest, "job %s has already finished", job.ID)
+		return
+	}
+	job.Status = "cancelled"
+	job.FinishedAt = time.Now().Unix()
+	job.event("info", "Fine-tuning job cancelled")
+	g.JSON(http.StatusOK, job.FineTuningJob)
+}
+
+func (s *Server) handleFineTuningEvents(g *gin.Context) {
+	limit, err := strconv.Atoi(g.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		apiError(g, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[g.Param("id")]
+	if !ok {
+		apiError(g, http.StatusNotFound, "no such fine-tuning job: %s", g.Param("id"))
+		return
+	}
+	// Newest first, as the API returns them.
+	events := []openai.FineTuneEvent{}
+	for i := len(job.events) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, job.events[i])
+	}
+	g.JSON(http.StatusOK, gin.H{"object": "list", "data": events, "has_more": len(job.events) > limit})
+}
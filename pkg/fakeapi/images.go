@@ -0,0 +1,176 @@
+package fakeapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxFakeImageSide bounds the images the fake draws.
+const maxFakeImageSide = 2048
+
+// fakeImage draws a gradient whose colors are derived from prompt, so
+// different prompts give visibly different images.
+func fakeImage(prompt string, width, height, index int) []byte {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s#%d", prompt, index)
+	sum := h.Sum32()
+	base := color.RGBA{R: uint8(sum), G: uint8(sum >> 8), B: uint8(sum >> 16), A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{
+				R: base.R + uint8(x*64/width),
+				G: base.G + uint8(y*64/height),
+				B: base.B,
+				A: 255,
+			})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// imageSize parses a size such as "1024x1024", defaulting to 1024x1024.
+func imageSize(size string) (int, int, error) {
+	if size == "" {
+		return 1024, 1024, nil
+	}
+	var w, h int
+	if _, err := fmt.Sscanf(size, "%dx%d", &w, &h); err != nil || w <= 0 || h <= 0 || w > maxFakeImageSide || h > maxFakeImageSide {
+		return 0, 0, fmt.Errorf("invalid size: %s", size)
+	}
+	return w, h, nil
+}
+
+func (s *Server) handleCreateImage(g *gin.Context) {
+	var req openai.ImageRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		apiError(g, http.StatusBadRequest, "invalid request: %s", err.Error())
+		return
+	}
+	if req.Prompt == "" {
+		apiError(g, http.StatusBadRequest, "prompt is required")
+		return
+	}
+	w, h, err := imageSize(req.Size)
+	if err != nil {
+		apiError(g, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	n := req.N
+	if n == 0 {
+		n = 1
+	}
+	if req.Model == openai.CreateImageModelDallE3 && n != 1 {
+		apiError(g, http.StatusBadRequest, "dall-e-3 only supports n=1")
+		return
+	}
+
+	revised := ""
+	if req.Model == openai.CreateImageModelDallE3 {
+		revised = "A detailed rendering of " + req.Prompt
+	}
+	g.JSON(http.StatusOK, s.imageResponse(g, req.Prompt, revised, req.ResponseFormat, w, h, n))
+}
+
+// imageResponse draws n images and returns them in the requested format.
+func (s *Server) imageResponse(g *gin.Context, prompt, revised, format string, w, h, n int) openai.ImageResponse {
+	resp := openai.ImageResponse{Created: time.Now().Unix()}
+	for i := 0; i < n; i++ {
+		b := fakeImage(prompt, w, h, i)
+		data := openai.ImageResponseDataInner{RevisedPrompt: revised}
+		if format == openai.CreateImageResponseFormatURL {
+			data.URL = s.storeImage(g, b)
+		} else {
+			data.B64JSON = base64.StdEncoding.EncodeToString(b)
+		}
+		resp.Data = append(resp.Data, data)
+	}
+	return resp
+}
+
+// handleImageUpload serves edits and variations. Like the real API it
+// insists on square PNG uploads under 4 MB.
+func (s *Server) handleImageUpload(g *gin.Context) {
+	name := "image"
+	for _, field := range []string{"image", "mask"} {
+		fh, err := g.FormFile(field)
+		if err != nil {
+			if field == "mask" {
+				continue
+			}
+			apiError(g, http.StatusBadRequest, "missing %s: %s", field, err.Error())
+			return
+		}
+		if fh.Size > 4<<20 {
+			apiError(g, http.StatusBadRequest, "%s must be less than 4 MB", field)
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			apiError(g, http.StatusInternalServerError, "%s", err.Error())
+			return
+		}
+		cfg, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			apiError(g, http.StatusBadRequest, "%s must be a valid PNG file", field)
+			return
+		}
+		if cfg.Width != cfg.Height {
+			apiError(g, http.StatusBadRequest, "%s must be square", field)
+			return
+		}
+		if field == "image" {
+			name = fh.Filename
+		}
+	}
+
+	w, h, err := imageSize(g.PostForm("size"))
+	if err != nil {
+		apiError(g, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	n, _ := strconv.Atoi(g.PostForm("n"))
+	if n == 0 {
+		n = 1
+	}
+	prompt := g.PostForm("prompt")
+	if prompt == "" {
+		prompt = "variation of " + name
+	}
+	g.JSON(http.StatusOK, s.imageResponse(g, prompt, "", g.PostForm("response_format"), w, h, n))
+}
+
+// storeImage keeps an image so it can be fetched by URL, and returns that URL.
+func (s *Server) storeImage(g *gin.Context, b []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("img")
+	s.images[id] = b
+	return fmt.Sprintf("http://%s/v1/images/content/%s", g.Request.Host, id)
+}
+
+func (s *Server) handleImageContent(g *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.images[g.Param("id")]
+	if !ok {
+		apiError(g, http.StatusNotFound, "no such image: %s", g.Param("id"))
+		return
+	}
+	g.Data(http.StatusOK, "image/png", b)
+}
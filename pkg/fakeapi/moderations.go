@@ -0,0 +1,58 @@
+package fakeapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// moderationTriggers are the words that make the fake flag text, so both
+// outcomes of a check can be exercised.
+var moderationTriggers = map[string]string{
+	"attack":   "violence",
+	"kill":     "violence",
+	"hate":     "hate",
+	"harass":   "harassment",
+	"threaten": "harassment/threatening",
+}
+
+func (s *Server) handleModerations(g *gin.Context) {
+	var req openai.ModerationRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		apiError(g, http.StatusBadRequest, "invalid request: %s", err.Error())
+		return
+	}
+	if req.Input == "" {
+		apiError(g, http.StatusBadRequest, "input is required")
+		return
+	}
+
+	var result openai.Result
+	text := strings.ToLower(req.Input)
+	for word, category := range moderationTriggers {
+		if !strings.Contains(text, word) {
+			continue
+		}
+		result.Flagged = true
+		switch category {
+		case "violence":
+			result.Categories.Violence, result.CategoryScores.Violence = true, 0.9
+		case "hate":
+			result.Categories.Hate, result.CategoryScores.Hate = true, 0.9
+		case "harassment":
+			result.Categories.Harassment, result.CategoryScores.Harassment = true, 0.9
+		case "harassment/threatening":
+			result.Categories.HarassmentThreatening, result.CategoryScores.HarassmentThreatening = true, 0.9
+		}
+	}
+	model := req.Model
+	if model == "" {
+		model = openai.ModerationOmniLatest
+	}
+	s.mu.Lock()
+	id := s.newID("modr")
+	s.mu.Unlock()
+	g.JSON(http.StatusOK, openai.ModerationResponse{ID: id, Model: model, Results: []openai.Result{result}})
+}
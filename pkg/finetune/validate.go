@@ -0,0 +1,246 @@
+// Package finetune checks chat fine-tuning data before it is uploaded. It
+// follows the checks of OpenAI's data preparation guide: every line is a
+// JSON object with a list of messages in known roles, every example has an
+// assistant reply to learn from, and no example is too long to train on.
+package finetune
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MinExamples is the fewest examples the API accepts for a training file.
+const MinExamples = 10
+
+// DefaultMaxTokens is the longest example the current chat models train on.
+// Longer examples are truncated.
+const DefaultMaxTokens = 65536
+
+// Limits are the sizes a file is checked against.
+type Limits struct {
+	MaxTokens   int // longest example in tokens; 0 means DefaultMaxTokens
+	MinExamples int // fewest examples; 0 for no minimum, as for validation files
+}
+
+// Token overheads of the chat format, per message and for the reply.
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+var roles = map[string]bool{"system": true, "user": true, "assistant": true, "tool": true, "function": true}
+
+var messageKeys = map[string]bool{
+	"role": true, "content": true, "name": true, "weight": true,
+	"tool_calls": true, "tool_call_id": true, "function_call": true, "refusal": true,
+}
+
+// Message is a chat message in a training example.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content,omitempty"`
+	Name    string `json:"name,omitempty"`
+	// Weight 0 excludes an assistant message from training; nil means 1.
+	Weight *int `json:"weight,omitempty"`
+}
+
+// Example is one line of a training file.
+type Example struct {
+	Messages []Message `json:"messages"`
+}
+
+// Problem is something in the file the API would reject or mishandle.
+type Problem struct {
+	Line    int    `json:"line,omitempty"` // 0 for problems with the whole file
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// Report summarises a training file.
+type Report struct {
+	Examples int       `json:"examples"`
+	Problems []Problem `json:"problems,omitempty"`
+	// Tokens are the estimated tokens of each example that could be read.
+	Tokens []int `json:"-"`
+	// MaxTokens is the length past which examples are truncated.
+	MaxTokens int `json:"max_tokens"`
+}
+
+// Validate reads a training or validation file and reports its problems
+// and estimated token counts. Only read errors are returned as errors.
+func Validate(r io.Reader, limits Limits) (*Report, error) {
+	maxTokens := limits.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+	report := &Report{MaxTokens: maxTokens}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		report.Examples++
+		tokens, problems := checkExample(sc.Bytes(), maxTokens)
+		for _, p := range problems {
+			report.Problems = append(report.Problems, Problem{Line: line, Message: p})
+		}
+		if tokens > 0 {
+			report.Tokens = append(report.Tokens, tokens)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if report.Examples < limits.MinExamples {
+		report.Problems = append(report.Problems, Problem{
+			Message: fmt.Sprintf("%d examples; fine-tuning needs at least %d", report.Examples, limits.MinExamples),
+		})
+	}
+	return report, nil
+}
+
+// checkExample returns the estimated tokens of one line and what is wrong
+// with it.
+func checkExample(line []byte, maxTokens int) (int, []string) {
+	var raw struct {
+		Messages []map[string]json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return 0, []string{fmt.Sprintf("invalid JSON: %s", err)}
+	}
+	if len(raw.Messages) == 0 {
+		return 0, []string{`no "messages" list`}
+	}
+
+	var problems []string
+	tokens := tokensPerReply
+	assistant := false
+	for i, m := range raw.Messages {
+		n := i + 1
+		for key := range m {
+			if !messageKeys[key] {
+				problems = append(problems, fmt.Sprintf("message %d: unknown key %q", n, key))
+			}
+		}
+		var role string
+		if err := json.Unmarshal(m["role"], &role); err != nil || !roles[role] {
+			problems = append(problems, fmt.Sprintf("message %d: role must be system, user, assistant or tool", n))
+			continue
+		}
+		text, ok := contentText(m["content"])
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("message %d: content must be a string or a list of parts", n))
+		case text == "" && !(role == "assistant" && (m["tool_calls"] != nil || m["function_call"] != nil)):
+			problems = append(problems, fmt.Sprintf("message %d: %s message has no content", n, role))
+		}
+		if w, ok := m["weight"]; ok {
+			if role != "assistant" {
+				problems = append(problems, fmt.Sprintf("message %d: only assistant messages can have a weight", n))
+			} else if s := string(w); s != "0" && s != "1" {
+				problems = append(problems, fmt.Sprintf("message %d: weight must be 0 or 1", n))
+			}
+		}
+		if role == "assistant" {
+			assistant = true
+		}
+		tokens += tokensPerMessage + EstimateTokens(text) + EstimateTokens(string(m["tool_calls"]))
+	}
+	if !assistant {
+		problems = append(problems, "no assistant message to learn from")
+	}
+	if tokens > maxTokens {
+		problems = append(problems, fmt.Sprintf("about %d tokens, over the limit of %d; it would be truncated", tokens, maxTokens))
+	}
+	return tokens, problems
+}
+
+// contentText returns the text of a message's content, which is a string,
+// a list of parts or absent. Only text parts are counted.
+func contentText(raw json.RawMessage) (string, bool) {
+	if raw == nil || string(raw) == "null" {
+		return "", true
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", false
+	}
+	var texts []string
+	for _, p := range parts {
+		texts = append(texts, p.Text)
+	}
+	return strings.Join(texts, "\n"), true
+}
+
+// EstimateTokens estimates the tokens in text at about four characters per
+// token, which is close for English prose and code with the GPT tokenizers.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// Epochs returns the number of epochs the API picks by default for n
+// examples: 3, raised or lowered to keep the examples seen between 100 and
+// 25,000.
+func Epochs(n int) int {
+	const target, minSeen, maxSeen = 3, 100, 25000
+	switch {
+	case n == 0:
+		return target
+	case n*target < minSeen:
+		e := (minSeen + n - 1) / n
+		if e > 25 {
+			e = 25
+		}
+		return e
+	case n*target > maxSeen:
+		e := maxSeen / n
+		if e < 1 {
+			e = 1
+		}
+		return e
+	}
+	return target
+}
+
+// BilledTokens estimates the tokens charged for training on the report's
+// examples for the given number of epochs. Truncated examples count only up
+// to the limit.
+func (r *Report) BilledTokens(epochs int) int {
+	total := 0
+	for _, t := range r.Tokens {
+		if t > r.MaxTokens {
+			t = r.MaxTokens
+		}
+		total += t
+	}
+	return total * epochs
+}
+
+// TokenRange returns the shortest, median and longest example in tokens.
+func (r *Report) TokenRange() (shortest, median, longest int) {
+	if len(r.Tokens) == 0 {
+		return 0, 0, 0
+	}
+	sorted := append([]int(nil), r.Tokens...)
+	sort.Ints(sorted)
+	return sorted[0], sorted[len(sorted)/2], sorted[len(sorted)-1]
+}
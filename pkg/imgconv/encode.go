@@ -0,0 +1,79 @@
+package imgconv
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Formats that Encode can write.
+const (
+	PNG  = "png"
+	JPEG = "jpeg"
+)
+
+// ParseFormat normalises a format name such as "jpg" or "PNG". WebP is
+// recognised but refused: the pure-Go WebP encoders need a newer Go than
+// this module targets.
+func ParseFormat(name string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "png":
+		return PNG, nil
+	case "jpg", "jpeg":
+		return JPEG, nil
+	case "webp":
+		return "", fmt.Errorf("WebP output is not supported; use png or jpeg")
+	}
+	return "", fmt.Errorf("unknown image format %q; use png or jpeg", name)
+}
+
+// FormatFromExt returns the format implied by the extension of path, or ""
+// when it has none.
+func FormatFromExt(path string) (string, error) {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		return "", nil
+	}
+	return ParseFormat(ext)
+}
+
+// Encode writes img to w in format. Quality, from 1 to 100, applies to
+// JPEG, which has no transparency, so transparent areas become white.
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case PNG:
+		return png.Encode(w, img)
+	case JPEG:
+		return jpeg.Encode(w, Flatten(img, color.White), &jpeg.Options{Quality: quality})
+	}
+	return fmt.Errorf("unknown image format %q", format)
+}
+
+// Flatten draws img over a solid background, removing transparency.
+func Flatten(img image.Image, bg color.Color) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// Thumbnail scales img down to fit in a max x max box, keeping its aspect
+// ratio. Images that already fit are returned unchanged.
+func Thumbnail(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := Fit(b.Dx(), b.Dy(), max)
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	return Resize(img, w, h)
+}
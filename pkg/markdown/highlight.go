@@ -0,0 +1,202 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+)
+
+// syntax describes just enough of a language to color its code.
+type syntax struct {
+	keywords     map[string]bool
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+	// spacedComments means a line comment only starts at the beginning of
+	// a line or after whitespace, as in shell, where # is also used in $#
+	// and ${#var}.
+	spacedComments bool
+}
+
+func newSyntax(keywords string, lineComments []string, blockComment [2]string, quotes string) *syntax {
+	s := &syntax{
+		keywords:     map[string]bool{},
+		lineComments: lineComments,
+		blockComment: blockComment,
+		quotes:       quotes,
+	}
+	for _, k := range strings.Fields(keywords) {
+		s.keywords[k] = true
+	}
+	return s
+}
+
+// withSpacedComments sets spacedComments and returns s.
+func (s *syntax) withSpacedComments() *syntax {
+	s.spacedComments = true
+	return s
+}
+
+var (
+	cComment   = [2]string{"/*", "*/"}
+	noComment  = [2]string{}
+	goSyntax   = newSyntax("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota", []string{"//"}, cComment, "\"'`")
+	pySyntax   = newSyntax("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False self", []string{"#"}, noComment, "\"'")
+	jsSyntax   = newSyntax("async await break case catch class const continue default delete do else export extends finally for from function if import in instanceof interface let new null of return static super switch this throw try type typeof undefined var void while yield true false", []string{"//"}, cComment, "\"'`")
+	shSyntax   = newSyntax("if then else elif fi for while until do done case esac in function return export local readonly set unset echo exit cd source", []string{"#"}, noComment, "\"'").withSpacedComments()
+	rustSyntax = newSyntax("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while Some None Ok Err", []string{"//"}, cComment, "\"")
+	cSyntax    = newSyntax("auto break case catch char class const continue default delete do double else enum extends extern final float for goto if implements import int long namespace new null nullptr package private protected public return short signed sizeof static struct switch template this throw throws try typedef union unsigned using virtual void volatile while true false bool string var", []string{"//"}, cComment, "\"'")
+	sqlSyntax  = newSyntax("select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit as distinct null is in like primary key references union all case when then else end", []string{"--"}, cComment, "'\"")
+	yamlSyntax = newSyntax("true false null yes no on off", []string{"#"}, noComment, "\"'").withSpacedComments()
+	jsonSyntax = newSyntax("true false null", nil, noComment, "\"")
+)
+
+// syntaxes maps fence languages to their syntax.
+var syntaxes = map[string]*syntax{
+	"go":         goSyntax,
+	"golang":     goSyntax,
+	"py":         pySyntax,
+	"python":     pySyntax,
+	"js":         jsSyntax,
+	"javascript": jsSyntax,
+	"jsx":        jsSyntax,
+	"ts":         jsSyntax,
+	"typescript": jsSyntax,
+	"tsx":        jsSyntax,
+	"sh":         shSyntax,
+	"bash":       shSyntax,
+	"shell":      shSyntax,
+	"zsh":        shSyntax,
+	"console":    shSyntax,
+	"rust":       rustSyntax,
+	"rs":         rustSyntax,
+	"c":          cSyntax,
+	"h":          cSyntax,
+	"cpp":        cSyntax,
+	"c++":        cSyntax,
+	"java":       cSyntax,
+	"cs":         cSyntax,
+	"csharp":     cSyntax,
+	"kotlin":     cSyntax,
+	"sql":        sqlSyntax,
+	"yaml":       yamlSyntax,
+	"yml":        yamlSyntax,
+	"json":       jsonSyntax,
+}
+
+// Colors used for code tokens.
+const (
+	keywordColor = "\x1b[35m"
+	stringColor  = "\x1b[32m"
+	numberColor  = "\x1b[33m"
+	commentColor = "\x1b[90m"
+	reset        = "\x1b[0m"
+)
+
+// highlighter colors code one line at a time, remembering block comments
+// that span lines.
+type highlighter struct {
+	syntax    *syntax
+	inComment bool
+}
+
+func newHighlighter(lang string) *highlighter {
+	return &highlighter{syntax: syntaxes[lang]}
+}
+
+// line returns line with ANSI colors added. Unknown languages are returned
+// unchanged.
+func (h *highlighter) line(line string) string {
+	s := h.syntax
+	if s == nil {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		if h.inComment {
+			end := strings.Index(rest, s.blockComment[1])
+			if end < 0 {
+				b.WriteString(commentColor + rest + reset)
+				break
+			}
+			end += len(s.blockComment[1])
+			b.WriteString(commentColor + rest[:end] + reset)
+			h.inComment = false
+			i += end
+			continue
+		}
+		if hasAnyPrefix(rest, s.lineComments) && (!s.spacedComments || i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			b.WriteString(commentColor + rest + reset)
+			break
+		}
+		if s.blockComment[0] != "" && strings.HasPrefix(rest, s.blockComment[0]) {
+			h.inComment = true
+			b.WriteString(commentColor + s.blockComment[0])
+			i += len(s.blockComment[0])
+			b.WriteString(reset)
+			continue
+		}
+		c := line[i]
+		switch {
+		case strings.IndexByte(s.quotes, c) >= 0:
+			end := stringEnd(line, i)
+			b.WriteString(stringColor + line[i:end] + reset)
+			i = end
+		case isDigit(c):
+			end := i
+			for end < len(line) && (isWordByte(line[end]) || line[end] == '.') {
+				end++
+			}
+			b.WriteString(numberColor + line[i:end] + reset)
+			i = end
+		case isWordByte(c):
+			end := i
+			for end < len(line) && isWordByte(line[end]) {
+				end++
+			}
+			word := line[i:end]
+			if s.keywords[word] || (s == sqlSyntax && s.keywords[strings.ToLower(word)]) {
+				b.WriteString(keywordColor + word + reset)
+			} else {
+				b.WriteString(word)
+			}
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// stringEnd returns the index just past the string literal starting at i,
+// or the end of the line if it is not closed.
+func stringEnd(line string, i int) int {
+	quote := line[i]
+	for j := i + 1; j < len(line); j++ {
+		switch line[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		}
+	}
+	return len(line)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || isDigit(c)
+}
@@ -0,0 +1,91 @@
+// Package markdown parses and renders the Markdown found in model replies.
+// The renderer and the code block extraction share the same fence parsing,
+// so a block shown on screen is the block that gets saved or copied.
+package markdown
+
+import "strings"
+
+// CodeBlock is a fenced code block found in a reply.
+type CodeBlock struct {
+	Lang string // language from the fence info string, lower case
+	Code string // content without the fences, ending in a newline
+}
+
+// CodeBlocks returns the fenced code blocks in text in order. A block left
+// open at the end of text, as in an interrupted reply, is included.
+func CodeBlocks(text string) []CodeBlock {
+	var (
+		blocks []CodeBlock
+		fence  string
+		cur    CodeBlock
+		code   strings.Builder
+	)
+	for _, line := range strings.Split(text, "\n") {
+		if fence == "" {
+			if f, lang, ok := openFence(line); ok {
+				fence, cur = f, CodeBlock{Lang: lang}
+				code.Reset()
+			}
+			continue
+		}
+		if closesFence(line, fence) {
+			cur.Code = code.String()
+			blocks = append(blocks, cur)
+			fence = ""
+			continue
+		}
+		code.WriteString(line)
+		code.WriteByte('\n')
+	}
+	if fence != "" {
+		if cur.Code = strings.TrimRight(code.String(), "\n"); cur.Code != "" {
+			cur.Code += "\n"
+		}
+		blocks = append(blocks, cur)
+	}
+	return blocks
+}
+
+// openFence reports whether line opens a fenced code block, returning the
+// fence itself and the language named after it.
+func openFence(line string) (fence, lang string, ok bool) {
+	trimmed, indent := trimIndent(line)
+	if indent > 3 || len(trimmed) < 3 {
+		return "", "", false
+	}
+	c := trimmed[0]
+	if c != '`' && c != '~' {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == c {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info := strings.TrimSpace(trimmed[n:])
+	if c == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	if fields := strings.Fields(info); len(fields) > 0 {
+		lang = strings.ToLower(strings.Trim(fields[0], "{}."))
+	}
+	return trimmed[:n], lang, true
+}
+
+// closesFence reports whether line closes a block opened with fence.
+func closesFence(line, fence string) bool {
+	trimmed, indent := trimIndent(line)
+	trimmed = strings.TrimRight(trimmed, " \t")
+	if indent > 3 || len(trimmed) < len(fence) {
+		return false
+	}
+	return strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// trimIndent removes leading spaces from line and returns how many there were.
+func trimIndent(line string) (string, int) {
+	trimmed := strings.TrimLeft(line, " ")
+	return trimmed, len(line) - len(trimmed)
+}
@@ -0,0 +1,365 @@
+package markdown
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/chzyer/readline/runes"
+)
+
+// Options control how replies are rendered.
+type Options struct {
+	Width int  // wrap text to this many columns; 0 disables wrapping
+	Color bool // use ANSI styles and syntax highlighting
+}
+
+// Styles used for Markdown elements.
+const (
+	bold      = "\x1b[1m"
+	italic    = "\x1b[3m"
+	underline = "\x1b[4m"
+	dim       = "\x1b[2m"
+	codeColor = "\x1b[36m"
+	quoteBar  = "\x1b[90m│\x1b[0m "
+)
+
+var (
+	headingRe  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	listRe     = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	tableSepRe = regexp.MustCompile(`^:?-+:?$`)
+)
+
+// Writer renders Markdown written to it a line at a time, so streamed
+// replies are displayed as they arrive. Tables are held back until they end.
+type Writer struct {
+	w     io.Writer
+	opts  Options
+	buf   []byte
+	fence string
+	hl    *highlighter
+	table []string
+}
+
+// NewWriter returns a Writer that renders to w.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	return &Writer{w: w, opts: opts}
+}
+
+// Write renders every complete line in p and buffers the rest.
+func (r *Writer) Write(p []byte) (int, error) {
+	r.buf = append(r.buf, p...)
+	for {
+		i := bytes.IndexByte(r.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(r.buf[:i])
+		r.buf = r.buf[i+1:]
+		if err := r.render(line, true); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Flush renders anything still buffered without a trailing newline and
+// resets the block state, ready for the next reply.
+func (r *Writer) Flush() error {
+	var err error
+	if len(r.buf) > 0 {
+		line := string(r.buf)
+		r.buf = r.buf[:0]
+		err = r.render(line, false)
+	}
+	if terr := r.flushTable(); err == nil {
+		err = terr
+	}
+	r.fence, r.hl = "", nil
+	return err
+}
+
+// Render renders a complete Markdown text.
+func Render(text string, opts Options) string {
+	var b strings.Builder
+	r := NewWriter(&b, opts)
+	r.Write([]byte(text))
+	r.Flush()
+	return b.String()
+}
+
+// render writes one source line, followed by a newline when newline is set.
+func (r *Writer) render(line string, newline bool) error {
+	line = strings.TrimSuffix(line, "\r")
+	if r.fence == "" && isTableRow(line) {
+		r.table = append(r.table, line)
+		if !newline {
+			return r.flushTable()
+		}
+		return nil
+	}
+	if err := r.flushTable(); err != nil {
+		return err
+	}
+
+	out := r.format(line)
+	if newline {
+		out += "\n"
+	}
+	_, err := io.WriteString(r.w, out)
+	return err
+}
+
+// format renders a single line outside of tables.
+func (r *Writer) format(line string) string {
+	if r.fence != "" {
+		if closesFence(line, r.fence) {
+			r.fence, r.hl = "", nil
+			return r.style(dim, line)
+		}
+		if r.opts.Color {
+			return r.hl.line(line)
+		}
+		return line
+	}
+	if fence, lang, ok := openFence(line); ok {
+		r.fence, r.hl = fence, newHighlighter(lang)
+		return r.style(dim, line)
+	}
+
+	if m := headingRe.FindStringSubmatch(line); m != nil {
+		if !r.opts.Color {
+			return r.wrap(line, "", "")
+		}
+		text := r.inline(m[2])
+		if len(m[1]) == 1 {
+			return r.wrap(bold+underline+text+reset, "", "")
+		}
+		return r.wrap(bold+text+reset, "", "")
+	}
+	if isRule(line) {
+		width := r.opts.Width
+		if width <= 0 || width > 80 {
+			width = 80
+		}
+		return r.style(dim, strings.Repeat("─", width))
+	}
+	if m := listRe.FindStringSubmatch(line); m != nil {
+		marker := m[2]
+		if marker == "-" || marker == "*" || marker == "+" {
+			marker = "•"
+		}
+		first := m[1] + marker + " "
+		return r.wrap(r.inline(m[3]), first, strings.Repeat(" ", visibleWidth(first)))
+	}
+	if strings.HasPrefix(line, ">") {
+		text := strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+		bar := "│ "
+		if r.opts.Color {
+			bar = quoteBar
+		}
+		return r.wrap(r.inline(text), bar, bar)
+	}
+	return r.wrap(r.inline(line), "", "")
+}
+
+// style wraps s in an ANSI style when color is enabled.
+func (r *Writer) style(code, s string) string {
+	if !r.opts.Color {
+		return s
+	}
+	return code + s + reset
+}
+
+// inline styles code spans, emphasis and links. Without color the text is
+// left as written.
+func (r *Writer) inline(s string) string {
+	if !r.opts.Color {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end >= 0 {
+				b.WriteString(codeColor + s[i+1:i+1+end] + reset)
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(s[i:], "**") || strings.HasPrefix(s[i:], "__"):
+			marker := s[i : i+2]
+			if end := strings.Index(s[i+2:], marker); end > 0 {
+				b.WriteString(bold + r.inline(s[i+2:i+2+end]) + reset)
+				i += end + 4
+				continue
+			}
+		case s[i] == '*' || (s[i] == '_' && (i == 0 || !isWordByte(s[i-1]))):
+			marker := s[i : i+1]
+			if end := strings.Index(s[i+1:], marker); end > 0 && s[i+1] != ' ' && s[i+end] != ' ' {
+				b.WriteString(italic + r.inline(s[i+1:i+1+end]) + reset)
+				i += end + 2
+				continue
+			}
+		case s[i] == '[':
+			if text, url, n, ok := parseLink(s[i:]); ok {
+				b.WriteString(underline + text + reset + dim + " (" + url + ")" + reset)
+				i += n
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+// parseLink parses a [text](url) link at the start of s.
+func parseLink(s string) (text, url string, n int, ok bool) {
+	close := strings.Index(s, "](")
+	if close < 0 || strings.IndexByte(s[1:close], ']') >= 0 {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(s[close:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	return s[1:close], s[close+2 : close+end], close + end + 1, true
+}
+
+// wrap word-wraps s to the terminal width, starting with first and
+// continuing each further line with indent.
+func (r *Writer) wrap(s, first, indent string) string {
+	width := r.opts.Width
+	if width <= 0 || visibleWidth(first)+visibleWidth(s) <= width {
+		return first + s
+	}
+	var b strings.Builder
+	b.WriteString(first)
+	col := visibleWidth(first)
+	start := col
+	for _, word := range strings.Split(s, " ") {
+		w := visibleWidth(word)
+		if col > start && col+1+w > width {
+			b.WriteString("\n" + indent)
+			col = visibleWidth(indent)
+			start = col
+		} else if col > start {
+			b.WriteByte(' ')
+			col++
+		}
+		b.WriteString(word)
+		col += w
+	}
+	return b.String()
+}
+
+// isRule reports whether line is a thematic break such as "---" or "* * *".
+func isRule(line string) bool {
+	t := strings.ReplaceAll(strings.TrimSpace(line), " ", "")
+	if len(t) < 3 || strings.IndexByte("-*_", t[0]) < 0 {
+		return false
+	}
+	return strings.Trim(t, t[:1]) == ""
+}
+
+// isTableRow reports whether line looks like a row of a pipe table.
+func isTableRow(line string) bool {
+	t := strings.TrimSpace(line)
+	return len(t) > 1 && t[0] == '|' && strings.Count(t, "|") >= 2
+}
+
+// flushTable renders the buffered table rows with aligned columns. Tables
+// too wide for the terminal are printed as written.
+func (r *Writer) flushTable() error {
+	if len(r.table) == 0 {
+		return nil
+	}
+	rows := r.table
+	r.table = nil
+
+	var cells [][]string
+	var widths []int
+	sepRow := -1
+	for i, row := range rows {
+		cols := splitRow(row)
+		if isSeparatorRow(cols) {
+			if sepRow < 0 {
+				sepRow = i
+			}
+			cells = append(cells, nil)
+			continue
+		}
+		for j, col := range cols {
+			cols[j] = r.inline(col)
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := visibleWidth(cols[j]); w > widths[j] {
+				widths[j] = w
+			}
+		}
+		cells = append(cells, cols)
+	}
+
+	total := 0
+	for _, w := range widths {
+		total += w + 3
+	}
+	if r.opts.Width > 0 && total > r.opts.Width {
+		_, err := io.WriteString(r.w, strings.Join(rows, "\n")+"\n")
+		return err
+	}
+
+	var b strings.Builder
+	for i, cols := range cells {
+		if cols == nil {
+			parts := make([]string, len(widths))
+			for j, w := range widths {
+				parts[j] = strings.Repeat("─", w)
+			}
+			b.WriteString(r.style(dim, "─"+strings.Join(parts, "─┼─")+"─") + "\n")
+			continue
+		}
+		parts := make([]string, len(widths))
+		for j, w := range widths {
+			var cell string
+			if j < len(cols) {
+				cell = cols[j]
+			}
+			if i < sepRow {
+				cell = r.style(bold, cell)
+			}
+			parts[j] = cell + strings.Repeat(" ", w-visibleWidth(cell))
+		}
+		b.WriteString(" " + strings.Join(parts, r.style(dim, " │ ")) + "\n")
+	}
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+// splitRow splits a table row into trimmed cells.
+func splitRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	cols := strings.Split(row, "|")
+	for i := range cols {
+		cols[i] = strings.TrimSpace(cols[i])
+	}
+	return cols
+}
+
+func isSeparatorRow(cols []string) bool {
+	for _, c := range cols {
+		if !tableSepRe.MatchString(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// visibleWidth returns the number of terminal columns s occupies, ignoring
+// ANSI styles.
+func visibleWidth(s string) int {
+	return runes.WidthAll(runes.ColorFilter([]rune(s)))
+}
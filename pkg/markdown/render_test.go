@@ -0,0 +1,102 @@
+package markdown
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// visible shows ANSI escapes as \e so golden files can be read and diffed.
+func visible(s string) string {
+	return strings.ReplaceAll(s, "\x1b", `\e`)
+}
+
+// TestRenderGolden renders each testdata/*.md file with color and compares
+// it with the matching .golden file. Run with -update to rewrite them.
+func TestRenderGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := visible(Render(string(src), Options{Color: true}))
+			golden := strings.TrimSuffix(file, ".md") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("rendered %s differs from %s:\n%s", file, golden, got)
+			}
+		})
+	}
+}
+
+// TestWriterChunks checks that a reply streamed in pieces, with lines and
+// fences split across writes, renders the same as the whole text.
+func TestWriterChunks(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Render(string(src), Options{Color: true})
+		for _, size := range []int{1, 2, 3, 7, 64} {
+			var b strings.Builder
+			w := NewWriter(&b, Options{Color: true})
+			for rest := src; len(rest) > 0; {
+				n := size
+				if n > len(rest) {
+					n = len(rest)
+				}
+				w.Write(rest[:n])
+				rest = rest[n:]
+			}
+			w.Flush()
+			if b.String() != want {
+				t.Errorf("%s written %d bytes at a time:\n%s\nwant:\n%s", file, size, visible(b.String()), visible(want))
+			}
+		}
+	}
+}
+
+func TestShellComments(t *testing.T) {
+	h := newHighlighter("sh")
+	tests := []struct {
+		line, comment string // comment is "" when the line has none
+	}{
+		{"# a comment", "# a comment"},
+		{"echo hi # a comment", "# a comment"},
+		{"echo hi\t# after a tab", "# after a tab"},
+		{"echo $#", ""},
+		{"echo ${#name}", ""},
+		{"url=http://example.com/#top", ""},
+	}
+	for _, tt := range tests {
+		got := h.line(tt.line)
+		switch {
+		case tt.comment == "" && strings.Contains(got, commentColor):
+			t.Errorf("%q has a comment: %s", tt.line, visible(got))
+		case tt.comment != "" && !strings.HasSuffix(got, commentColor+tt.comment+reset):
+			t.Errorf("%q = %s, want the comment %q", tt.line, visible(got), tt.comment)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Package retry provides an HTTP client that retries failed API calls with
+// exponential backoff, honouring Retry-After headers sent by the server.
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Policy controls how requests are retried.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the backoff before the second attempt; it doubles with
+	// every further attempt up to MaxDelay. A server asking to wait longer
+	// than MaxDelay with Retry-After is not retried.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Timeout limits each attempt, including reading the response body.
+	// Event streams are only limited until their headers arrive, since a
+	// streamed reply takes as long as the model writes. Zero means no
+	// timeout.
+	Timeout time.Duration
+	// Logf, when set, receives a line for every retried attempt.
+	Logf func(format string, args ...any)
+}
+
+// DefaultPolicy returns the policy used when nothing is configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Timeout:     2 * time.Minute,
+	}
+}
+
+// Backoff returns a randomized delay to wait before the given attempt
+// (starting at 2), using exponential backoff with full jitter.
+func (p *Policy) Backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 2; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func (p *Policy) logf(format string, args ...any) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+	}
+}
+
+// Client sends requests according to a Policy. It satisfies the HTTPDoer
+// interface expected by the go-openai client configuration.
+type Client struct {
+	HTTP   *http.Client
+	Policy *Policy
+}
+
+// NewClient creates a client that applies policy to every request.
+func NewClient(policy *Policy) *Client {
+	return &Client{HTTP: &http.Client{}, Policy: policy}
+}
+
+// Retryable reports whether a response status is worth retrying.
+func Retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusRequestTimeout,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RetryAfter returns the delay requested by the server, if any.
+func RetryAfter(h http.Header) (time.Duration, bool) {
+	if ms := h.Get("Retry-After-Ms"); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil && n >= 0 {
+			return time.Duration(n * float64(time.Millisecond)), true
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Do sends req, retrying network errors and retryable status codes until
+// the policy's attempts are used up or the request context is done. A
+// request that is not idempotent, such as a POST, is not retried when it
+// timed out after being sent.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	p := c.Policy
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(req, attempt)
+
+		var reason string
+		switch {
+		case err != nil:
+			var sent *sentError
+			if errors.As(err, &sent) {
+				p.logf("%s %s: not retrying, the request may have been processed (%s)", req.Method, req.URL.Path, err)
+				return nil, sent.err
+			}
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			reason = err.Error()
+		case Retryable(resp.StatusCode) && !quotaExceeded(resp):
+			reason = resp.Status
+		default:
+			if attempt > 1 {
+				p.logf("%s %s: %s after %d attempts", req.Method, req.URL.Path, resp.Status, attempt)
+			}
+			return resp, nil
+		}
+
+		if attempt >= attempts {
+			p.logf("%s %s: giving up after %d attempts (%s)", req.Method, req.URL.Path, attempt, reason)
+			return resp, err
+		}
+
+		wait := p.Backoff(attempt + 1)
+		if resp != nil {
+			if d, ok := RetryAfter(resp.Header); ok {
+				if p.MaxDelay > 0 && d > p.MaxDelay {
+					p.logf("%s %s: giving up, server asked to wait %s (%s)", req.Method, req.URL.Path, d.Round(time.Second), reason)
+					return resp, nil
+				}
+				wait = d
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		p.logf("%s %s: attempt %d/%d failed (%s), retrying in %s",
+			req.Method, req.URL.Path, attempt, attempts, reason, wait.Round(time.Millisecond))
+		if err := Sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends one copy of req, bounded by the policy timeout.
+func (c *Client) attempt(req *http.Request, n int) (*http.Response, error) {
+	r := req
+	if n > 1 {
+		if req.Body != nil && req.GetBody == nil {
+			return nil, fmt.Errorf("cannot retry %s %s: request body is not replayable", req.Method, req.URL.Path)
+		}
+		r = req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+	}
+
+	if c.Policy.Timeout <= 0 {
+		return c.HTTP.Do(r)
+	}
+
+	var written atomic.Bool
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) { written.Store(true) },
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	body := &cancelBody{timeout: c.Policy.Timeout}
+	timer := time.AfterFunc(c.Policy.Timeout, func() {
+		body.timedOut.Store(true)
+		cancel()
+	})
+	body.cancel = func() {
+		timer.Stop()
+		cancel()
+	}
+	resp, err := c.HTTP.Do(r.WithContext(ctx))
+	if err != nil {
+		body.cancel()
+		err = body.wrap(err)
+		if body.timedOut.Load() && written.Load() && !idempotent(r) {
+			return nil, &sentError{err}
+		}
+		return nil, err
+	}
+	if isEventStream(resp) {
+		timer.Stop()
+	}
+	body.ReadCloser = resp.Body
+	resp.Body = body
+	return resp, nil
+}
+
+// idempotent reports whether req can safely be sent again after the
+// server may already have acted on it, using the same rules as net/http.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// sentError is an attempt that timed out after a request that is not
+// idempotent was sent. Retrying it could, for example, bill a completion
+// twice.
+type sentError struct {
+	err error
+}
+
+func (e *sentError) Error() string { return e.err.Error() }
+func (e *sentError) Unwrap() error { return e.err }
+
+// isEventStream reports whether resp is a stream of server-sent events.
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+}
+
+// quotaExceeded reports whether a 429 response means the account is out of
+// quota, which no amount of retrying will fix. The body is restored so the
+// caller can still read it.
+func quotaExceeded(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	return err == nil && strings.Contains(string(b), "insufficient_quota")
+}
+
+// Sleep waits for d, returning the context's error early if it is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// cancelBody releases the attempt's timeout context once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel   context.CancelFunc
+	timeout  time.Duration
+	timedOut atomic.Bool
+}
+
+func (b *cancelBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != io.EOF {
+		err = b.wrap(err)
+	}
+	return n, err
+}
+
+// wrap explains an error caused by the attempt running out of time.
+func (b *cancelBody) wrap(err error) error {
+	if err != nil && b.timedOut.Load() {
+		return fmt.Errorf("attempt timed out after %s: %w", b.timeout, err)
+	}
+	return err
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
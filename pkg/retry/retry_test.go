@@ -0,0 +1,261 @@
+package retry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPolicy retries quickly so the tests do not wait on backoff.
+func testPolicy() *Policy {
+	return &Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+}
+
+// countingServer serves each request with handle, passing the 1-based
+// number of the call, and returns the server with its call counter.
+func countingServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, call int)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w, r, int(calls.Add(1)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func get(t *testing.T, c *Client, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Do(req)
+}
+
+func post(t *testing.T, c *Client, url string, body io.Reader) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.Do(req)
+}
+
+// wait pauses a handler for d, or until the client gives up on the request.
+func wait(r *http.Request, d time.Duration) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(d):
+	}
+}
+
+func TestRetriesRetryableStatus(t *testing.T) {
+	srv, calls := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		if call == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+	resp, err := get(t, NewClient(testPolicy()), srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+func TestQuotaExceededIsNotRetried(t *testing.T) {
+	const body = `{"error":{"code":"insufficient_quota"}}`
+	srv, calls := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, body)
+	})
+	resp, err := get(t, NewClient(testPolicy()), srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("calls = %d, want 1", n)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil || string(b) != body {
+		t.Errorf("body = %q, %v; want %q", b, err, body)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+		ok     bool
+	}{
+		{"none", nil, 0, false},
+		{"seconds", map[string]string{"Retry-After": "2"}, 2 * time.Second, true},
+		{"milliseconds", map[string]string{"Retry-After-Ms": "1500"}, 1500 * time.Millisecond, true},
+		{"fractional milliseconds", map[string]string{"Retry-After-Ms": "2.5"}, 2500 * time.Microsecond, true},
+		{"milliseconds win", map[string]string{"Retry-After": "10", "Retry-After-Ms": "20"}, 20 * time.Millisecond, true},
+		{"bad milliseconds", map[string]string{"Retry-After": "3", "Retry-After-Ms": "soon"}, 3 * time.Second, true},
+		{"past date", map[string]string{"Retry-After": "Mon, 02 Jan 2006 15:04:05 GMT"}, 0, true},
+		{"negative", map[string]string{"Retry-After": "-1"}, 0, false},
+		{"garbage", map[string]string{"Retry-After": "later"}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			got, ok := RetryAfter(h)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("RetryAfter = %s, %t; want %s, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRetryAfterIsHonoured(t *testing.T) {
+	var first time.Time
+	var gap time.Duration
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		if call == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After-Ms", "100")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		gap = time.Since(first)
+	})
+	resp, err := get(t, NewClient(testPolicy()), srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if gap < 100*time.Millisecond {
+		t.Errorf("retried after %s, want at least 100ms", gap)
+	}
+}
+
+func TestRetryAfterBeyondMaxDelayGivesUp(t *testing.T) {
+	srv, calls := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	resp, err := get(t, NewClient(testPolicy()), srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("calls = %d, want 1", n)
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	srv, calls := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		if call == 1 {
+			wait(r, time.Second)
+		}
+		io.WriteString(w, "ok")
+	})
+	p := testPolicy()
+	p.Timeout = 50 * time.Millisecond
+	resp, err := get(t, NewClient(p), srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+func TestAttemptTimeoutCoversBody(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		wait(r, time.Second)
+	})
+	p := testPolicy()
+	p.Timeout = 50 * time.Millisecond
+	resp, err := get(t, NewClient(p), srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("read error = %v, want a timeout", err)
+	}
+}
+
+func TestTimedOutPostIsNotRetried(t *testing.T) {
+	srv, calls := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		wait(r, time.Second)
+	})
+	p := testPolicy()
+	p.Timeout = 50 * time.Millisecond
+	_, err := post(t, NewClient(p), srv.URL, strings.NewReader(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("post error = %v, want a timeout", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("calls = %d, want 1", n)
+	}
+}
+
+func TestEventStreamIsNotTimed(t *testing.T) {
+	srv, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			io.WriteString(w, "data: tick\n\n")
+			w.(http.Flusher).Flush()
+			wait(r, 50*time.Millisecond)
+		}
+	})
+	p := testPolicy()
+	p.Timeout = 50 * time.Millisecond
+	resp, err := get(t, NewClient(p), srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if n := strings.Count(string(b), "tick"); n != 3 {
+		t.Errorf("events = %d, want 3", n)
+	}
+}
+
+func TestBodyNotReplayable(t *testing.T) {
+	srv, calls := countingServer(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	// A reader net/http cannot rewind leaves the request without GetBody.
+	body := io.MultiReader(strings.NewReader(`{}`))
+	_, err := post(t, NewClient(testPolicy()), srv.URL, body)
+	if err == nil || !strings.Contains(err.Error(), "not replayable") {
+		t.Errorf("post error = %v, want a replay error", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("calls = %d, want 1", n)
+	}
+}
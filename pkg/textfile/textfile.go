@@ -0,0 +1,27 @@
+// Package textfile tells text files from binary ones before their content
+// is shown to a model or indexed.
+package textfile
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of a file is looked at, as git does.
+const sniffLen = 8000
+
+// IsBinary reports whether b looks like binary data rather than UTF-8 text,
+// judging by its first 8000 bytes.
+func IsBinary(b []byte) bool {
+	if len(b) > sniffLen {
+		b = b[:sniffLen]
+	}
+	if bytes.IndexByte(b, 0) >= 0 {
+		return true
+	}
+	// Allow a multi-byte rune cut off by the sample limit.
+	for i := 0; i < 4 && len(b) > 0 && !utf8.Valid(b); i++ {
+		b = b[:len(b)-1]
+	}
+	return !utf8.Valid(b)
+}
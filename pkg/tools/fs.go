@@ -0,0 +1,323 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hmm01i/openai/pkg/textfile"
+)
+
+// Approver asks the user to confirm an action and reports whether it was
+// allowed.
+type Approver func(prompt string) bool
+
+// AlwaysApprove allows every action without asking.
+func AlwaysApprove(string) bool { return true }
+
+// NeverApprove refuses every action that needs confirmation.
+func NeverApprove(string) bool { return false }
+
+const (
+	maxReadBytes   = 100 * 1024
+	maxGrepMatches = 200
+	maxGrepFile    = 1024 * 1024
+)
+
+// Sandbox confines file access to a single root directory.
+type Sandbox struct {
+	root string
+}
+
+// NewSandbox creates a sandbox rooted at dir, which must exist.
+func NewSandbox(dir string) (*Sandbox, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &Sandbox{root: root}, nil
+}
+
+// Root returns the absolute root directory of the sandbox.
+func (s *Sandbox) Root() string {
+	return s.root
+}
+
+// Resolve maps a path relative to the root onto the filesystem and rejects
+// anything, including symlink targets, that falls outside the root.
+func (s *Sandbox) Resolve(name string) (string, error) {
+	p := filepath.Clean(name)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(s.root, p)
+	}
+
+	// Resolve symlinks in the longest existing prefix of the path.
+	existing, rest := p, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	real = filepath.Join(real, rest)
+
+	rel, err := filepath.Rel(s.root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the allowed directory %s", name, s.root)
+	}
+	return real, nil
+}
+
+func (s *Sandbox) rel(p string) string {
+	rel, err := filepath.Rel(s.root, p)
+	if err != nil {
+		return p
+	}
+	return rel
+}
+
+// RegisterFilesystem adds read_file, list_directory, grep and write_file
+// tools confined to the sandbox. Every write is passed to approve first.
+func RegisterFilesystem(r *Registry, s *Sandbox, approve Approver) error {
+	for _, t := range []*Tool{
+		{
+			Name:        "read_file",
+			Description: "Read a text file. Paths are relative to the project root.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"path": {"type": "string", "description": "File path relative to the project root"}
+				},
+				"required": ["path"]
+			}`),
+			Handler: s.readFile,
+		},
+		{
+			Name:        "list_directory",
+			Description: "List the entries of a directory. Directories end with a slash.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"path": {"type": "string", "description": "Directory path relative to the project root, default \".\""}
+				}
+			}`),
+			Handler: s.listDirectory,
+		},
+		{
+			Name:        "grep",
+			Description: "Search text files recursively for a regular expression and return matching lines as path:line: text.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"pattern": {"type": "string", "description": "Go regular expression"},
+					"path": {"type": "string", "description": "File or directory to search, default \".\""}
+				},
+				"required": ["pattern"]
+			}`),
+			Handler: s.grep,
+		},
+		{
+			Name:        "write_file",
+			Description: "Create or overwrite a text file. The user must approve every write.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"path": {"type": "string", "description": "File path relative to the project root"},
+					"content": {"type": "string", "description": "Complete new content of the file"}
+				},
+				"required": ["path", "content"]
+			}`),
+			Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+				return s.writeFile(args, approve)
+			},
+		},
+	} {
+		if err := r.Register(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type fsArgs struct {
+	Path    string `json:"path"`
+	Pattern string `json:"pattern"`
+	Content string `json:"content"`
+}
+
+func parseFSArgs(args json.RawMessage) (fsArgs, error) {
+	var a fsArgs
+	if err := json.Unmarshal(args, &a); err != nil {
+		return a, err
+	}
+	if a.Path == "" {
+		a.Path = "."
+	}
+	return a, nil
+}
+
+func (s *Sandbox) readFile(ctx context.Context, args json.RawMessage) (string, error) {
+	a, err := parseFSArgs(args)
+	if err != nil {
+		return "", err
+	}
+	p, err := s.Resolve(a.Path)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	if textfile.IsBinary(b) {
+		return "", fmt.Errorf("%s is a binary file", a.Path)
+	}
+	if len(b) > maxReadBytes {
+		return fmt.Sprintf("%s\n[truncated: showing %d of %d bytes]", b[:maxReadBytes], maxReadBytes, len(b)), nil
+	}
+	return string(b), nil
+}
+
+func (s *Sandbox) listDirectory(ctx context.Context, args json.RawMessage) (string, error) {
+	a, err := parseFSArgs(args)
+	if err != nil {
+		return "", err
+	}
+	p, err := s.Resolve(a.Path)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return "", err
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() {
+			out = append(out, e.Name()+"/")
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s (%d bytes)", e.Name(), info.Size()))
+	}
+	if len(out) == 0 {
+		return "(empty directory)", nil
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+func (s *Sandbox) grep(ctx context.Context, args json.RawMessage) (string, error) {
+	a, err := parseFSArgs(args)
+	if err != nil {
+		return "", err
+	}
+	re, err := regexp.Compile(a.Pattern)
+	if err != nil {
+		return "", err
+	}
+	p, err := s.Resolve(a.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if path != p && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err != nil || !info.Mode().IsRegular() || info.Size() > maxGrepFile {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil || textfile.IsBinary(b) {
+			return nil
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		scanner.Buffer(make([]byte, 0, 64*1024), maxGrepFile)
+		for n := 1; scanner.Scan(); n++ {
+			if re.Match(scanner.Bytes()) {
+				matches = append(matches, fmt.Sprintf("%s:%d: %s", s.rel(path), n, scanner.Text()))
+				if len(matches) >= maxGrepMatches {
+					return fs.SkipAll
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "no matches", nil
+	}
+	if len(matches) >= maxGrepMatches {
+		matches = append(matches, fmt.Sprintf("[stopped after %d matches]", maxGrepMatches))
+	}
+	return strings.Join(matches, "\n"), nil
+}
+
+func (s *Sandbox) writeFile(args json.RawMessage, approve Approver) (string, error) {
+	a, err := parseFSArgs(args)
+	if err != nil {
+		return "", err
+	}
+	p, err := s.Resolve(a.Path)
+	if err != nil {
+		return "", err
+	}
+
+	action := "create"
+	if _, err := os.Stat(p); err == nil {
+		action = "overwrite"
+	}
+	if !approve(fmt.Sprintf("Allow the model to %s %s (%d bytes)?", action, s.rel(p), len(a.Content))) {
+		return "", fmt.Errorf("the user declined to write %s", a.Path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(p, []byte(a.Content), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote %d bytes to %s", len(a.Content), s.rel(p)), nil
+}
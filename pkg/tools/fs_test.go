@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestSandbox builds a sandbox with a sub directory, a file in it and
+// symlinks pointing both inside and outside the root. It returns the
+// sandbox and the directory outside it.
+func newTestSandbox(t *testing.T) (*Sandbox, string) {
+	t.Helper()
+	root, outside := t.TempDir(), t.TempDir()
+	mustWrite(t, filepath.Join(root, "sub", "a.txt"), "a")
+	mustWrite(t, filepath.Join(outside, "secret.txt"), "secret")
+	for link, target := range map[string]string{
+		"in":      filepath.Join(root, "sub"),
+		"out":     outside,
+		"outfile": filepath.Join(outside, "secret.txt"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	s, err := NewSandbox(root)
+	if err != nil {
+		t.Fatalf("new sandbox: %v", err)
+	}
+	return s, outside
+}
+
+func mustWrite(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSandboxResolve(t *testing.T) {
+	s, outside := newTestSandbox(t)
+	root := s.Root()
+	tests := []struct {
+		name string
+		path string
+		want string // "" when the path must be refused
+	}{
+		{"root", ".", root},
+		{"file", "sub/a.txt", filepath.Join(root, "sub", "a.txt")},
+		{"dot dot inside", "sub/../sub/a.txt", filepath.Join(root, "sub", "a.txt")},
+		{"new file", "new/dir/b.txt", filepath.Join(root, "new", "dir", "b.txt")},
+		{"absolute inside", filepath.Join(root, "sub", "a.txt"), filepath.Join(root, "sub", "a.txt")},
+		{"symlink inside", "in/a.txt", filepath.Join(root, "sub", "a.txt")},
+		{"new file under symlink inside", "in/new.txt", filepath.Join(root, "sub", "new.txt")},
+		{"dot dot", "..", ""},
+		{"dot dot escape", "../x.txt", ""},
+		{"nested dot dot escape", "sub/../../x.txt", ""},
+		{"absolute outside", filepath.Join(outside, "secret.txt"), ""},
+		{"absolute system file", "/etc/passwd", ""},
+		{"symlinked dir outside", "out", ""},
+		{"file in symlinked dir outside", "out/secret.txt", ""},
+		{"symlinked file outside", "outfile", ""},
+		{"new file under symlink outside", "out/new.txt", ""},
+		{"new dir under symlink outside", "out/a/b/new.txt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Resolve(tt.path)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("Resolve(%q) = %q, want an error", tt.path, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Resolve(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFileNeverApproved(t *testing.T) {
+	s, _ := newTestSandbox(t)
+	r := NewRegistry()
+	if err := RegisterFilesystem(r, s, NeverApprove); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	for _, path := range []string{"sub/a.txt", "b.txt"} {
+		if _, err := r.Call(context.Background(), "write_file", `{"path": "`+path+`", "content": "changed"}`); err == nil {
+			t.Errorf("write_file %s succeeded without approval", path)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(s.Root(), "sub", "a.txt")); err != nil || string(b) != "a" {
+		t.Errorf("sub/a.txt = %q, %v; want it unchanged", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Root(), "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("b.txt was created: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShellConfig limits what the run_command tool may do.
+type ShellConfig struct {
+	// Dir is the working directory for commands.
+	Dir string
+	// Timeout is the wall-clock limit for a command.
+	Timeout time.Duration
+	// CPUSeconds is the CPU time limit, enforced with ulimit -t.
+	CPUSeconds int
+	// MaxOutput caps the bytes of stdout and stderr returned to the model.
+	MaxOutput int
+	// AuditLog is the file every approved or declined command is appended to.
+	AuditLog string
+}
+
+// shellEnv is the only environment passed to commands; nothing else from
+// the user's environment, such as API tokens, leaks through.
+var shellEnv = []string{
+	"PATH=/usr/local/bin:/usr/bin:/bin",
+	"LANG=C.UTF-8",
+	"TERM=dumb",
+}
+
+// Events recorded in the shell audit log. A command that is run has a
+// started entry before it runs and a finished entry once it exits.
+const (
+	auditDeclined = "declined"
+	auditStarted  = "started"
+	auditFinished = "finished"
+)
+
+// auditEntry is one line of the shell audit log.
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Shell    string    `json:"shell"`
+	Command  string    `json:"command"`
+	Dir      string    `json:"dir"`
+	Approved bool      `json:"approved"`
+	ExitCode int       `json:"exit_code"`
+	Duration string    `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Shell runs commands within the limits of a ShellConfig, asking before
+// each one and recording it in the audit log. It backs the run_command tool
+// and snippets the user runs themselves.
+type Shell struct {
+	config  ShellConfig
+	approve Approver
+	mu      sync.Mutex
+}
+
+// NewShell returns a Shell for config that asks approve before every
+// command.
+func NewShell(config ShellConfig, approve Approver) (*Shell, error) {
+	if config.AuditLog == "" {
+		return nil, fmt.Errorf("running commands requires an audit log")
+	}
+	if config.Timeout <= 0 {
+		return nil, fmt.Errorf("running commands requires a positive timeout, not %s", config.Timeout)
+	}
+	return &Shell{config: config, approve: approve}, nil
+}
+
+// ShellResult is the outcome of a command that was run.
+type ShellResult struct {
+	ExitCode int // -1 if the command was stopped
+	Stdout   string
+	Stderr   string
+	// Error says why the command was stopped, such as a timeout.
+	Error string
+	// Warning reports a problem recording the finished command.
+	Warning string
+}
+
+// ErrDeclined is returned by Shell.Run when the user does not approve.
+var ErrDeclined = errors.New("the user declined to run the command")
+
+// RegisterShell adds the run_command tool. Every command is shown to
+// approve before it runs and recorded in the audit log.
+func RegisterShell(r *Registry, config ShellConfig, approve Approver) error {
+	s, err := NewShell(config, approve)
+	if err != nil {
+		return fmt.Errorf("run_command: %w", err)
+	}
+	return r.Register(&Tool{
+		Name: "run_command",
+		Description: "Run a shell command with /bin/sh after the user approves it. " +
+			"Returns stdout, stderr and the exit code. Commands have a time limit and a minimal environment.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"command": {"type": "string", "description": "Shell command line to run"}
+			},
+			"required": ["command"]
+		}`),
+		Handler: s.runTool,
+	})
+}
+
+// limitedBuffer keeps the first max bytes written to it and counts the rest.
+type limitedBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	room := b.max - b.buf.Len()
+	if room >= len(p) {
+		return b.buf.Write(p)
+	}
+	if room > 0 {
+		b.buf.Write(p[:room])
+		b.dropped += len(p) - room
+	} else {
+		b.dropped += len(p)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	if b.dropped > 0 {
+		return fmt.Sprintf("%s\n[truncated %d bytes]", b.buf.String(), b.dropped)
+	}
+	return b.buf.String()
+}
+
+func (s *Shell) runTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var a struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(a.Command) == "" {
+		return "", fmt.Errorf("empty command")
+	}
+	res, err := s.Run(ctx, "/bin/sh", a.Command,
+		fmt.Sprintf("Allow the model to run `%s` in %s?", a.Command, s.config.Dir))
+	if err != nil {
+		return "", err
+	}
+
+	result := fmt.Sprintf("exit code: %d\nstdout:\n%s\nstderr:\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	if res.Error != "" {
+		result = "error: " + res.Error + "\n" + result
+	}
+	if res.Warning != "" {
+		result = "warning: " + res.Warning + "\n" + result
+	}
+	return result, nil
+}
+
+// Run asks for approval with prompt and then runs command with program,
+// such as /bin/sh or bash, in the configured directory. Commands that are
+// declined, or that cannot be recorded before they start, are not run.
+func (s *Shell) Run(ctx context.Context, program, command, prompt string) (*ShellResult, error) {
+	entry := auditEntry{Time: time.Now(), Shell: program, Command: command, Dir: s.config.Dir, ExitCode: -1}
+	if !s.approve(prompt) {
+		entry.Event = auditDeclined
+		if err := s.audit(entry); err != nil {
+			return nil, fmt.Errorf("%w, and it could not be recorded: %v", ErrDeclined, err)
+		}
+		return nil, ErrDeclined
+	}
+	entry.Approved = true
+	entry.Event = auditStarted
+	if err := s.audit(entry); err != nil {
+		return nil, fmt.Errorf("not running the command because it could not be recorded: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	script := command
+	if s.config.CPUSeconds > 0 {
+		script = fmt.Sprintf("ulimit -t %d\n%s", s.config.CPUSeconds, command)
+	}
+	cmd := exec.CommandContext(ctx, program, "-c", script)
+	cmd.Dir = s.config.Dir
+	cmd.Env = shellEnv
+	cmd.WaitDelay = time.Second
+	killProcessGroup(cmd)
+	stdout := &limitedBuffer{max: s.config.MaxOutput}
+	stderr := &limitedBuffer{max: s.config.MaxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	entry.Time = time.Now()
+	entry.Event = auditFinished
+	entry.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		entry.ExitCode = 0
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		entry.Error = fmt.Sprintf("timed out after %s", s.config.Timeout)
+	case ctx.Err() != nil:
+		entry.Error = "cancelled"
+	case errors.As(err, &exitErr):
+		entry.ExitCode = exitErr.ExitCode()
+	default:
+		entry.Error = err.Error()
+		if auditErr := s.audit(entry); auditErr != nil {
+			return nil, errors.Join(err, auditErr)
+		}
+		return nil, err
+	}
+
+	res := &ShellResult{
+		ExitCode: entry.ExitCode,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Error:    entry.Error,
+	}
+	if err := s.audit(entry); err != nil {
+		// The command has already run, so its output is still returned.
+		res.Warning = fmt.Sprintf("the result could not be recorded: %s", err)
+	}
+	return res, nil
+}
+
+// audit appends entry to the audit log.
+func (s *Shell) audit(entry auditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.config.AuditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(entry); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+// killProcessGroup leaves cancellation to exec.CommandContext, which kills
+// only the shell, where process groups are not available.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShellNeverApproved(t *testing.T) {
+	dir := t.TempDir()
+	config := ShellConfig{
+		Dir:       dir,
+		Timeout:   5 * time.Second,
+		MaxOutput: 1024,
+		AuditLog:  filepath.Join(t.TempDir(), "audit.log"),
+	}
+	r := NewRegistry()
+	if err := RegisterShell(r, config, NeverApprove); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	_, err := r.Call(context.Background(), "run_command", `{"command": "touch ran"}`)
+	if !errors.Is(err, ErrDeclined) {
+		t.Errorf("run_command error = %v, want %v", err, ErrDeclined)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran")); !os.IsNotExist(err) {
+		t.Errorf("the declined command ran: %v", err)
+	}
+
+	f, err := os.Open(config.AuditLog)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer f.Close()
+	var entries []auditEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 1 || entries[0].Event != auditDeclined || entries[0].Approved || entries[0].Command != "touch ran" {
+		t.Errorf("audit log = %+v, want one declined entry for the command", entries)
+	}
+}
@@ -0,0 +1,133 @@
+// Package tools implements a registry of functions that chat models can call.
+// Each tool declares a JSON schema for its arguments and a Go handler that
+// runs when the model requests it.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Handler runs a tool with the JSON arguments supplied by the model and
+// returns the text that is sent back as the tool result.
+type Handler func(ctx context.Context, args json.RawMessage) (string, error)
+
+// Tool describes a function that the model can call
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters json.RawMessage
+	Handler    Handler
+}
+
+// Registry manages the tools offered to the model
+type Registry struct {
+	tools map[string]*Tool
+}
+
+// NewRegistry creates an empty tool registry
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]*Tool)}
+}
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// schema is the subset of JSON schema checked before a handler runs.
+type schema struct {
+	Type     string   `json:"type"`
+	Required []string `json:"required"`
+}
+
+// Register adds a tool, rejecting duplicate names and invalid schemas
+func (r *Registry) Register(t *Tool) error {
+	if !validName.MatchString(t.Name) {
+		return fmt.Errorf("invalid tool name %q", t.Name)
+	}
+	if _, exists := r.tools[t.Name]; exists {
+		return fmt.Errorf("tool %s is already registered", t.Name)
+	}
+	if t.Handler == nil {
+		return fmt.Errorf("tool %s has no handler", t.Name)
+	}
+	if len(t.Parameters) == 0 {
+		t.Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	var s schema
+	if err := json.Unmarshal(t.Parameters, &s); err != nil {
+		return fmt.Errorf("tool %s: invalid parameter schema: %w", t.Name, err)
+	}
+	if s.Type != "object" {
+		return fmt.Errorf("tool %s: parameter schema must be of type object", t.Name)
+	}
+	r.tools[t.Name] = t
+	return nil
+}
+
+// Get returns the tool with the given name
+func (r *Registry) Get(name string) (*Tool, bool) {
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Names returns the registered tool names in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Len returns the number of registered tools
+func (r *Registry) Len() int {
+	return len(r.tools)
+}
+
+// Definitions returns the tools in the form expected by the chat API
+func (r *Registry) Definitions() []openai.Tool {
+	var defs []openai.Tool
+	for _, name := range r.Names() {
+		t := r.tools[name]
+		defs = append(defs, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	return defs
+}
+
+// Call validates the arguments against the tool's schema and runs it
+func (r *Registry) Call(ctx context.Context, name, args string) (string, error) {
+	t, ok := r.tools[name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+	if args == "" {
+		args = "{}"
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(args), &fields); err != nil {
+		return "", fmt.Errorf("tool %s: arguments must be a JSON object: %w", name, err)
+	}
+	var s schema
+	json.Unmarshal(t.Parameters, &s)
+	for _, req := range s.Required {
+		if _, ok := fields[req]; !ok {
+			return "", fmt.Errorf("tool %s: missing required argument %q", name, req)
+		}
+	}
+
+	return t.Handler(ctx, json.RawMessage(args))
+}
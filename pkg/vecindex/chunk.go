@@ -0,0 +1,101 @@
+package vecindex
+
+import "strings"
+
+// Piece is a span of a document produced by Split.
+type Piece struct {
+	Text      string
+	StartLine int // first line, counting from 1
+	EndLine   int // last line, inclusive
+}
+
+// Split cuts text into pieces of about size bytes for embedding. It packs
+// whole paragraphs together where it can, splits long paragraphs between
+// lines and very long lines between words. Blank pieces are dropped. A
+// size of zero or less keeps the whole text in one piece.
+func Split(text string, size int) []Piece {
+	if size <= 0 {
+		size = len(text) + 1
+	}
+	var pieces []Piece
+	var cur []string
+	start, n := 0, 0
+
+	flush := func(end int) {
+		body := strings.TrimSpace(strings.Join(cur, "\n"))
+		if body != "" {
+			pieces = append(pieces, Piece{Text: body, StartLine: start, EndLine: end})
+		}
+		cur, n = nil, 0
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); {
+		// Gather the paragraph starting at line i.
+		j := i
+		for j < len(lines) && strings.TrimSpace(lines[j]) != "" {
+			j++
+		}
+		para := lines[i:j]
+		paraLen := len(strings.Join(para, "\n"))
+
+		if n > 0 && n+paraLen > size {
+			flush(i)
+		}
+		for k, line := range para {
+			for len(line) > size {
+				cut := strings.LastIndex(line[:size], " ")
+				if cut <= 0 {
+					cut = size
+					for cut > 1 && line[cut]&0xc0 == 0x80 {
+						cut-- // keep multi-byte characters whole
+					}
+				}
+				if n > 0 {
+					flush(i + k)
+				}
+				start = i + k + 1
+				cur, n = []string{line[:cut]}, cut
+				flush(i + k + 1)
+				line = strings.TrimLeft(line[cut:], " ")
+			}
+			if n > 0 && n+len(line) > size {
+				flush(i + k)
+			}
+			if n == 0 {
+				start = i + k + 1
+			}
+			cur = append(cur, line)
+			n += len(line) + 1
+		}
+		if j > i {
+			cur = append(cur, "")
+			n++
+		}
+		// Skip the blank lines after the paragraph.
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		if j == i {
+			j++
+		}
+		i = j
+	}
+	flush(len(lines))
+	for i := range pieces {
+		pieces[i].EndLine = lastLine(pieces[i], lines)
+	}
+	return pieces
+}
+
+// lastLine trims the end of a piece back to its last non-blank line.
+func lastLine(p Piece, lines []string) int {
+	end := p.EndLine
+	if end > len(lines) {
+		end = len(lines)
+	}
+	for end > p.StartLine && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return end
+}
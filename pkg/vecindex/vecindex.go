@@ -0,0 +1,199 @@
+// Package vecindex is a small on-disk vector index for embeddings. It keeps
+// every chunk in memory and searches them exhaustively by cosine
+// similarity, which is fast enough for tens of thousands of chunks.
+package vecindex
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	metaFile   = "index.json"
+	chunksFile = "chunks.jsonl"
+)
+
+// Chunk is a piece of a source document and its embedding.
+type Chunk struct {
+	Source    string    `json:"source"`
+	Hash      string    `json:"hash,omitempty"` // hash of the whole source when it was indexed
+	StartLine int       `json:"start_line,omitempty"`
+	EndLine   int       `json:"end_line,omitempty"`
+	Text      string    `json:"text"`
+	Vector    []float32 `json:"vector"`
+}
+
+// Result is a chunk found by Search.
+type Result struct {
+	Chunk
+	Score float32
+}
+
+// Index is a set of chunks embedded with one model.
+type Index struct {
+	Dir        string    `json:"-"`
+	Model      string    `json:"model"`
+	Dimensions int       `json:"dimensions"`
+	Updated    time.Time `json:"updated"`
+	Chunks     []Chunk   `json:"-"`
+}
+
+// Open loads the index stored in dir. A missing directory gives an empty
+// index that Save will create.
+func Open(dir string) (*Index, error) {
+	ix := &Index{Dir: dir}
+	b, err := os.ReadFile(filepath.Join(dir, metaFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, ix); err != nil {
+		return nil, fmt.Errorf("invalid index %s: %w", dir, err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, chunksFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		var c Chunk
+		if err := json.Unmarshal(sc.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("invalid index %s: chunk %d: %w", dir, line, err)
+		}
+		ix.Chunks = append(ix.Chunks, c)
+	}
+	return ix, sc.Err()
+}
+
+// Exists reports whether dir holds a saved index.
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, metaFile))
+	return err == nil
+}
+
+// SourceHash returns the hash recorded for source, or "" if it is not in
+// the index.
+func (ix *Index) SourceHash(source string) string {
+	for _, c := range ix.Chunks {
+		if c.Source == source {
+			return c.Hash
+		}
+	}
+	return ""
+}
+
+// Sources returns the distinct sources in the index with their chunk counts.
+func (ix *Index) Sources() map[string]int {
+	sources := make(map[string]int)
+	for _, c := range ix.Chunks {
+		sources[c.Source]++
+	}
+	return sources
+}
+
+// Replace swaps the chunks of source for chunks. Every vector must have the
+// index's dimensions; the first chunk added to an empty index sets them.
+func (ix *Index) Replace(source string, chunks []Chunk) error {
+	for _, c := range chunks {
+		if ix.Dimensions == 0 {
+			ix.Dimensions = len(c.Vector)
+		}
+		if len(c.Vector) != ix.Dimensions {
+			return fmt.Errorf("%s: embedding has %d dimensions, the index has %d", source, len(c.Vector), ix.Dimensions)
+		}
+	}
+	kept := ix.Chunks[:0]
+	for _, c := range ix.Chunks {
+		if c.Source != source {
+			kept = append(kept, c)
+		}
+	}
+	ix.Chunks = append(kept, chunks...)
+	return nil
+}
+
+// Save writes the index to its directory, replacing the files atomically.
+func (ix *Index) Save() error {
+	if err := os.MkdirAll(ix.Dir, 0700); err != nil {
+		return err
+	}
+	ix.Updated = time.Now()
+
+	tmp, err := os.CreateTemp(ix.Dir, chunksFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, c := range ix.Chunks {
+		if err := enc.Encode(c); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(ix.Dir, chunksFile)); err != nil {
+		return err
+	}
+
+	meta, err := json.MarshalIndent(ix, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(ix.Dir, metaFile), meta, 0644)
+}
+
+// Search returns the k chunks most similar to vector, best first.
+func (ix *Index) Search(vector []float32, k int) []Result {
+	results := make([]Result, 0, len(ix.Chunks))
+	for _, c := range ix.Chunks {
+		results = append(results, Result{Chunk: c, Score: Cosine(vector, c.Vector)})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 if their lengths
+// differ or either is zero.
+func Cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(na*nb))
+}